@@ -0,0 +1,92 @@
+package blobstore
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	ManifestFile = "SHA256SUMS"
+)
+
+// Manifest maps the files served by the blobstore to their pinned sha256 digest.
+type Manifest map[string]string
+
+// LoadManifest reads the SHA256SUMS file (as written by sha256sum) from dir.
+func LoadManifest(dir string) (Manifest, error) {
+	f, err := os.Open(filepath.Join(dir, ManifestFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open blobstore manifest: %s", err)
+	}
+	defer f.Close()
+
+	m := make(Manifest)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid blobstore manifest line: %s", scanner.Text())
+		}
+		name := strings.TrimPrefix(fields[1], "*")
+		if name != filepath.Base(name) {
+			return nil, fmt.Errorf("blobstore manifest entry %s is not a plain file name", name)
+		}
+		m[name] = strings.ToLower(fields[0])
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read blobstore manifest: %s", err)
+	}
+	return m, nil
+}
+
+// Verify checks every file in the manifest against its pinned digest.
+func (m Manifest) Verify(dir string) error {
+	for name, digest := range m {
+		if err := VerifyFile(filepath.Join(dir, name), digest); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// VerifyFile checks the sha256 digest of the file at path.
+func VerifyFile(path, digest string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return fmt.Errorf("failed to hash %s: %s", path, err)
+	}
+	actual := hex.EncodeToString(h.Sum(nil))
+	if actual != strings.ToLower(strings.TrimPrefix(digest, "sha256:")) {
+		return fmt.Errorf("digest mismatch for %s expected: %s got: %s", path, digest, actual)
+	}
+	return nil
+}
+
+// Handler serves the files listed in the manifest from dir, and nothing else.
+func (m Manifest) Handler(dir string) http.Handler {
+	files := http.FileServer(http.Dir(dir))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/")
+		if _, ok := m[name]; !ok && name != ManifestFile {
+			http.NotFound(w, r)
+			return
+		}
+		files.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,79 @@
+package blobstore_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/starkandwayne/molten-core/blobstore"
+)
+
+var _ = Describe("Blobstore", func() {
+	var dir string
+
+	// sha256 of "release"
+	const releaseDigest = "a4d451ec23463726f72c43d64c710968f6b602cd653b4de8adee1b556240a829"
+
+	write := func(name, contents string) {
+		Expect(ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "blobstore")
+		Expect(err).ToNot(HaveOccurred())
+		write("bosh-dns-1.17.0.tgz", "release")
+		write("secret.txt", "secret")
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("verifies files against the manifest", func() {
+		write(ManifestFile, "d0c1fb1ae9d02f8ba4d2b0e1ea1e9e7df4ad0e7ab1ba2e6de8b2d5a2d1f3f0c0  bosh-dns-1.17.0.tgz\n")
+		m, err := LoadManifest(dir)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(m.Verify(dir)).To(MatchError(ContainSubstring("digest mismatch")))
+	})
+
+	Context("given a valid manifest", func() {
+		var m Manifest
+
+		BeforeEach(func() {
+			write(ManifestFile, releaseDigest+"  bosh-dns-1.17.0.tgz\n")
+			var err error
+			m, err = LoadManifest(dir)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("verifies", func() {
+			Expect(m).To(HaveKeyWithValue("bosh-dns-1.17.0.tgz", releaseDigest))
+			Expect(m.Verify(dir)).To(Succeed())
+		})
+
+		It("only serves files from the manifest", func() {
+			srv := httptest.NewServer(m.Handler(dir))
+			defer srv.Close()
+
+			resp, err := http.Get(srv.URL + "/bosh-dns-1.17.0.tgz")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+			resp, err = http.Get(srv.URL + "/secret.txt")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp.StatusCode).To(Equal(http.StatusNotFound))
+		})
+	})
+
+	It("rejects manifest entries outside the blobstore", func() {
+		write(ManifestFile, releaseDigest+"  ../etc/passwd\n")
+		_, err := LoadManifest(dir)
+		Expect(err).To(HaveOccurred())
+	})
+})
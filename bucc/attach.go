@@ -0,0 +1,115 @@
+package bucc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/docker/docker/pkg/term"
+)
+
+func isTerminal(f *os.File) bool {
+	_, ok := term.GetFdInfo(f)
+	return ok
+}
+
+// attach starts the container with the stdio of mc attached to it. When
+// running in a terminal it is put in raw mode and resizes are propagated.
+// started is called as soon as the container is running.
+func (c *Client) attach(ctx context.Context, id string, tty bool, started func(),
+	statusCh <-chan container.ContainerWaitOKBody, errCh <-chan error) error {
+	hijacked, err := c.dcli.ContainerAttach(ctx, id, types.ContainerAttachOptions{
+		Stream: true,
+		Stdin:  true,
+		Stdout: true,
+		Stderr: true,
+	})
+	if err != nil {
+		return fmt.Errorf("failed attach to docker container: %s", err)
+	}
+	defer hijacked.Close()
+
+	if err := c.dcli.ContainerStart(ctx, id, types.ContainerStartOptions{}); err != nil {
+		return fmt.Errorf("failed start docker container: %s", err)
+	}
+	started()
+
+	if tty {
+		fd, _ := term.GetFdInfo(os.Stdin)
+		state, err := term.SetRawTerminal(fd)
+		if err != nil {
+			return fmt.Errorf("failed to set terminal in raw mode: %s", err)
+		}
+		defer term.RestoreTerminal(fd, state)
+
+		stop := c.propagateResize(ctx, id, fd)
+		defer stop()
+	}
+
+	outputDone := make(chan error, 1)
+	go func() {
+		var err error
+		if tty {
+			_, err = io.Copy(os.Stdout, hijacked.Reader)
+		} else {
+			_, err = stdcopy.StdCopy(os.Stdout, os.Stderr, hijacked.Reader)
+		}
+		outputDone <- err
+	}()
+
+	go func() {
+		io.Copy(hijacked.Conn, os.Stdin)
+		hijacked.CloseWrite()
+	}()
+
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("gave up on docker container: %s", ctx.Err())
+	case err := <-outputDone:
+		if err != nil {
+			return fmt.Errorf("failed to read docker container output: %s", err)
+		}
+	}
+	return waitExit(ctx, statusCh, errCh)
+}
+
+// propagateResize resizes the container tty to the terminal size,
+// initially and on every SIGWINCH, until the returned func is called.
+func (c *Client) propagateResize(ctx context.Context, id string, fd uintptr) func() {
+	resize := func() {
+		ws, err := term.GetWinsize(fd)
+		if err != nil || ws.Height == 0 || ws.Width == 0 {
+			return
+		}
+		c.dcli.ContainerResize(ctx, id, types.ResizeOptions{
+			Height: uint(ws.Height),
+			Width:  uint(ws.Width),
+		})
+	}
+	resize()
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGWINCH)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-sigCh:
+				resize()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(sigCh)
+		close(done)
+	}
+}
@@ -131,7 +131,7 @@ func renderCloudConfig(confs *[]config.NodeConfig) (string, error) {
 		if err != nil {
 			return "", fmt.Errorf("failed to determine cloud config gatway: %s", err)
 		}
-		resMax, err := conf.Subnet.Host(numberOfReservedIPs + 1)
+		resMax, err := conf.Subnet.Host(lastReservedHost)
 		if err != nil {
 			return "", fmt.Errorf("failed to determine cloud config reserved range: %s", err)
 		}
@@ -4,14 +4,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"strconv"
 
 	"github.com/starkandwayne/molten-core/config"
 )
 
 const (
-	dockerSocket  = "/run/docker.sock"
-	concoursePort = "1443"
-	uaaPort       = "1444"
+	dockerSocket = "/run/docker.sock"
 )
 
 type Vars struct {
@@ -27,27 +26,37 @@ type Vars struct {
 	UAAHostPort       string `json:"uaa_host_port"`
 }
 
-func writeVars(path string, c *config.NodeConfig) error {
+func newVars(c *config.NodeConfig, b config.BUCC) (*Vars, error) {
 	gw, err := c.Subnet.Host(1)
 	if err != nil {
-		return fmt.Errorf("failed to get gatway ip: %s", err)
+		return nil, fmt.Errorf("failed to get gatway ip: %s", err)
 	}
-	buccIP, err := c.Subnet.Host(10)
+	if err = ValidateIPHostIndex(b.IPHostIndex); err != nil {
+		return nil, err
+	}
+	buccIP, err := b.InternalIP(c.Subnet)
 	if err != nil {
-		return fmt.Errorf("failed to get bucc ip: %s", err)
+		return nil, fmt.Errorf("failed to get bucc ip: %s", err)
 	}
 
-	vars := Vars{
-		DirectorName:      "moltencore",
-		Alias:             "mc",
+	return &Vars{
+		DirectorName:      b.DirectorName,
+		Alias:             b.Alias,
 		DockerHost:        dockerSocket,
 		Network:           config.BOSHDockerNetworkName,
 		InternalCIDR:      c.Subnet.String(),
 		InternalGW:        gw.String(),
 		InternalIP:        buccIP.String(),
 		HostIP:            c.PublicIP.String(),
-		ConcourseHostPort: concoursePort,
-		UAAHostPort:       uaaPort,
+		ConcourseHostPort: strconv.Itoa(b.ConcoursePort),
+		UAAHostPort:       strconv.Itoa(b.UAAPort),
+	}, nil
+}
+
+func writeVars(path string, c *config.NodeConfig, b config.BUCC) error {
+	vars, err := newVars(c, b)
+	if err != nil {
+		return err
 	}
 
 	data, err := json.Marshal(vars)
@@ -1,14 +1,14 @@
 package bucc
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
-	"io/ioutil"
-	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
@@ -16,40 +16,87 @@ import (
 	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/client"
 	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/sirupsen/logrus"
 
 	"github.com/starkandwayne/molten-core/config"
+	"github.com/starkandwayne/molten-core/util"
 )
 
 const (
-	buccImage             = "starkandwayne/mc-bucc:latest"
-	buccHostStateDir      = "/var/lib/moltencore/bucc"
+	buccHostStateDir      = config.BUCCStateDir
 	buccContainerStateDir = "/bucc/state"
 	credhubMoltenCorePath = "/concourse/main/moltencore"
+	logsDrainTimeout      = 5 * time.Second
+	containerStopTimeout  = 10 * time.Second
+	// buccLockFile serializes deploying BUCC between mc processes on the node
+	buccLockFile = "/run/lock/mc-bucc.lock"
 )
 
 type Client struct {
-	logger *log.Logger
-	config *config.NodeConfig
-	dcli   *client.Client
+	logger       *logrus.Entry
+	config       *config.NodeConfig
+	cluster      *config.ClusterConfig
+	registryAuth *config.RegistryAuth
+	dcli         *client.Client
+	image        string
+	stateDir     string
 }
 
-func NewClient(l *log.Logger, conf *config.NodeConfig) (*Client, error) {
-	ctx := context.Background()
-	cli, err := client.NewClientWithOpts(client.FromEnv)
+func NewClient(ctx context.Context, l *logrus.Entry, conf *config.NodeConfig, cc *config.ClusterConfig) (*Client, error) {
+	cli, err := util.NewDockerClient(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create docker client: %s", err)
+		return nil, err
 	}
-	cli.NegotiateAPIVersion(ctx)
 
-	return &Client{logger: l, config: conf, dcli: cli}, nil
+	ra, err := config.LoadRegistryAuth()
+	if err != nil {
+		cli.Close()
+		return nil, err
+	}
+
+	return &Client{logger: l.WithField("zone", conf.Zone()), config: conf, cluster: cc, registryAuth: ra, dcli: cli,
+		image:    cc.Image(cc.BUCCImageOrDefault(DefaultImage())),
+		stateDir: buccHostStateDir}, nil
+}
+
+// Close closes the connections to docker.
+func (c *Client) Close() error {
+	return c.dcli.Close()
+}
+
+func (c *Client) Up(ctx context.Context) error {
+	release, err := lockFile(buccLockFile)
+	if err != nil {
+		return fmt.Errorf("failed to lock %s: %s", buccLockFile, err)
+	}
+	defer release()
+	return c.up(ctx)
 }
 
-func (c *Client) Up() error {
+// EnsureUp runs Up unless the director is running, and reports whether it
+// did. The director is checked after waiting for other mc processes
+// deploying BUCC, e.g. an upgrade.
+func (c *Client) EnsureUp(ctx context.Context) (bool, error) {
+	release, err := lockFile(buccLockFile)
+	if err != nil {
+		return false, fmt.Errorf("failed to lock %s: %s", buccLockFile, err)
+	}
+	defer release()
+
+	running, err := c.DirectorRunning(ctx)
+	if err != nil || running {
+		return false, err
+	}
+	c.logger.Info("BOSH director is not running, deploying BUCC")
+	return true, c.up(ctx)
+}
+
+func (c *Client) up(ctx context.Context) error {
 	if err := c.writeStateDir(); err != nil {
 		return err
 	}
 
-	return c.run([]string{
+	err := c.run(ctx, []string{
 		"/bucc/bin/bucc",
 		"up",
 		"--recreate",
@@ -58,74 +105,133 @@ func (c *Client) Up() error {
 		"--unix-sock",
 		"--host-bind-concourse",
 	}, false)
+	if err != nil {
+		return err
+	}
+	if err = c.writeDeployedImage(); err != nil {
+		return err
+	}
+
+	c.logger.Info("Storing BUCC vars and creds in etcd")
+	if err = c.SaveState(ctx); err != nil {
+		return fmt.Errorf("failed to store BUCC state: %s", err)
+	}
+	return nil
 }
 
-func (c *Client) Shell() error {
-	return c.run([]string{"/bin/bash", "-c",
+// DirectorRunning reports whether the director deployed by Up is running,
+// it is not after a reboot of the node.
+func (c *Client) DirectorRunning(ctx context.Context) (bool, error) {
+	res, err := inspectDirector(ctx, c.dcli)
+	if res == nil || err != nil {
+		return false, err
+	}
+	return res.State.Running, nil
+}
+
+// DirectorRestarts returns how often docker restarted the director container,
+// it is 0 when no director has been deployed.
+func DirectorRestarts(ctx context.Context, cli *client.Client) (int, error) {
+	res, err := inspectDirector(ctx, cli)
+	if res == nil || err != nil {
+		return 0, err
+	}
+	return res.RestartCount, nil
+}
+
+// inspectDirector returns nil when no director has been deployed, or its
+// container does not exist anymore.
+func inspectDirector(ctx context.Context, cli *client.Client) (*types.ContainerJSON, error) {
+	id, err := deployedDirector()
+	if err != nil || id == "" {
+		return nil, err
+	}
+	res, err := cli.ContainerInspect(ctx, id)
+	if client.IsErrNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect director container: %s", err)
+	}
+	return &res, nil
+}
+
+func (c *Client) Shell(ctx context.Context) error {
+	return c.run(ctx, []string{"/bin/bash", "-c",
 		"/bin/bash --init-file <(echo 'source ~/.bashrc && bucc fly >/dev/null')"}, true)
 }
 
-func (c *Client) UpdateCloudConfig(confs *[]config.NodeConfig) error {
+// Exec runs command with the environment from bucc env, passing on its
+// stdin, stdout, stderr and exit status.
+func (c *Client) Exec(ctx context.Context, command []string) error {
+	return c.run(ctx, append([]string{"/bin/bash", "-c",
+		`source <(/bucc/bin/bucc env) && exec "$@"`, "mc-exec"}, command...), true)
+}
+
+// Fly runs fly against the Concourse target of BUCC, logging in first.
+func (c *Client) Fly(ctx context.Context, args []string) error {
+	script := fmt.Sprintf(`source <(/bucc/bin/bucc env) && bucc fly >/dev/null && exec fly -t %s "$@"`,
+		shellQuote(c.cluster.BUCC.Alias))
+	return c.run(ctx, append([]string{"/bin/bash", "-c", script, "mc-fly"}, args...), true)
+}
+
+func (c *Client) UpdateCloudConfig(ctx context.Context, confs *[]config.NodeConfig) error {
 	data, err := renderCloudConfig(confs)
 	if err != nil {
 		return fmt.Errorf("failed to render Cloud Config: %s", err)
 	}
-	return c.updateBoshConfig("cloud", data)
+	return c.updateBoshConfig(ctx, "cloud", data)
 }
 
-func (c *Client) UpdateCPIConfig(confs *[]config.NodeConfig) error {
+func (c *Client) UpdateCPIConfig(ctx context.Context, confs *[]config.NodeConfig) error {
 	data, err := renderCPIConfig(confs)
 	if err != nil {
 		return fmt.Errorf("failed to render CPI Config: %s", err)
 	}
-	return c.updateBoshConfig("cpi", data)
+	return c.updateBoshConfig(ctx, "cpi", data)
 }
 
-func (c *Client) UpdateRuntimeConfig(confs *[]config.NodeConfig) error {
-	return c.updateBoshConfig("runtime", renderRuntimeConfig())
+func (c *Client) UpdateRuntimeConfig(ctx context.Context) error {
+	recursors, err := util.LookupDNSRecursors()
+	if err != nil {
+		c.logger.Warnf("Failed to lookup host DNS recursors: %s", err)
+	}
+
+	rc := c.cluster.Runtime
+	if c.cluster.Offline.Enabled {
+		rc.BOSHDNS.URL = fmt.Sprintf("%s/%s-%s.tgz", c.cluster.BlobstoreURL(*c.config),
+			rc.BOSHDNS.Name, rc.BOSHDNS.Version)
+	}
+
+	data, err := RenderRuntimeConfig(rc, recursors)
+	if err != nil {
+		return fmt.Errorf("failed to render Runtime Config: %s", err)
+	}
+	return c.updateBoshConfig(ctx, "runtime", data)
 }
 
-func (c *Client) UpdateMoltenCoreConfig(confs *[]config.NodeConfig) error {
-	data, err := RenderMoltenCoreConfig(confs)
+func (c *Client) UpdateMoltenCoreConfig(ctx context.Context, confs *[]config.NodeConfig) error {
+	data, err := RenderMoltenCoreConfig(confs, c.cluster)
 	if err != nil {
 		return fmt.Errorf("failed to render MoltenCore Config: %s", err)
 	}
-	return c.credHubSet(credhubMoltenCorePath, data)
+	return c.credHubSet(ctx, credhubMoltenCorePath, data)
 }
 
-func (c *Client) updateBoshConfig(t, config string) error {
-	cmd := fmt.Sprintf("source <(/bucc/bin/bucc env) && bosh -n update-%s-config <(echo '%s')", t, config)
-	return c.run([]string{"/bin/bash", "-c", cmd}, false)
+func (c *Client) updateBoshConfig(ctx context.Context, t, config string) error {
+	cmd := fmt.Sprintf("source <(/bucc/bin/bucc env) && bosh -n update-%s-config <(echo %s)", t, shellQuote(config))
+	return c.run(ctx, []string{"/bin/bash", "-c", cmd}, false)
 }
 
-func (c *Client) credHubSet(path, config string) error {
-	cmd := fmt.Sprintf("source <(/bucc/bin/bucc env) && credhub set -n %s -t json -v '%s'", path, config)
-	return c.run([]string{"/bin/bash", "-c", cmd}, false)
+func (c *Client) credHubSet(ctx context.Context, path, config string) error {
+	cmd := fmt.Sprintf("source <(/bucc/bin/bucc env) && credhub set -n %s -t json -v %s", path, shellQuote(config))
+	return c.run(ctx, []string{"/bin/bash", "-c", cmd}, false)
 }
 
-func (c *Client) pullImage() error {
-	ctx := context.Background()
-	images, err := c.dcli.ImageList(ctx, types.ImageListOptions{})
-	if err != nil {
-		return fmt.Errorf("failed to list images: %s", err)
-	}
-	for _, img := range images {
-		for _, tag := range img.RepoTags {
-			if tag == buccImage {
-				return nil
-			}
-		}
-	}
-
-	c.logger.Printf("Pulling MoltenCore docker image, this can take a while")
-	reader, err := c.dcli.ImagePull(ctx, buccImage, types.ImagePullOptions{})
-	if err != nil {
-		return fmt.Errorf("failed to pull image %s: %s", buccImage, err)
-	}
-
-	defer reader.Close()
-	io.Copy(ioutil.Discard, reader)
-	return nil
+// shellQuote wraps s in single quotes, operator supplied addons may contain
+// quotes of their own.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
 }
 
 func (c *Client) writeStateDir() error {
@@ -133,37 +239,59 @@ func (c *Client) writeStateDir() error {
 		return fmt.Errorf("failed to create state dir: %s", err)
 	}
 
-	err := writeVars(filepath.Join(buccHostStateDir, "vars.yml"), c.config)
+	err := writeVars(filepath.Join(buccHostStateDir, varsFile), c.config, c.cluster.BUCC)
 	if err != nil {
 		return fmt.Errorf("failed to write vars file: %s", err)
 	}
 	return nil
 }
 
-func (c *Client) run(entrypoint []string, tty bool) error {
-	if err := c.pullImage(); err != nil {
+// ExitError is returned when the process in a container exits non-zero.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("container process exited with status %d", e.Code)
+}
+
+func (e *ExitError) ExitCode() int {
+	return e.Code
+}
+
+func (c *Client) run(ctx context.Context, entrypoint []string, interactive bool) error {
+	if err := c.pullImage(ctx); err != nil {
 		return err
 	}
 
-	// TODO limit ip range to reserved range
+	tty := interactive && isTerminal(os.Stdin) && isTerminal(os.Stdout)
+
+	ip, release, err := c.allocateIP(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to allocate container ip: %s", err)
+	}
+	defer release()
+
 	networks := make(map[string]*network.EndpointSettings)
-	networks[config.BOSHDockerNetworkName] = &network.EndpointSettings{}
+	networks[config.BOSHDockerNetworkName] = &network.EndpointSettings{
+		IPAMConfig: &network.EndpointIPAMConfig{IPv4Address: ip.String()},
+	}
 
-	ctx := context.Background()
 	resp, err := c.dcli.ContainerCreate(ctx, &container.Config{
-		AttachStdin:  tty,
-		AttachStdout: tty,
-		AttachStderr: tty,
+		AttachStdin:  interactive,
+		AttachStdout: interactive,
+		AttachStderr: interactive,
 		Tty:          tty,
-		OpenStdin:    tty,
-		Image:        buccImage,
+		OpenStdin:    interactive,
+		StdinOnce:    interactive,
+		Image:        c.image,
 		Entrypoint:   entrypoint,
 	}, &container.HostConfig{
 		AutoRemove: true,
 		Mounts: []mount.Mount{
 			{
 				Type:        mount.TypeBind,
-				Source:      buccHostStateDir,
+				Source:      c.stateDir,
 				Target:      buccContainerStateDir,
 				Consistency: mount.ConsistencyFull,
 				ReadOnly:    false,
@@ -182,73 +310,121 @@ func (c *Client) run(entrypoint []string, tty bool) error {
 	if err != nil {
 		return fmt.Errorf("failed create docker container: %s", err)
 	}
+	started := false
+	defer func() {
+		if !started || ctx.Err() != nil {
+			c.removeContainer(resp.ID)
+		}
+	}()
+
+	// wait before starting, an auto removed container might be gone otherwise
+	statusCh, errCh := c.dcli.ContainerWait(ctx, resp.ID, container.WaitConditionNextExit)
+
+	if interactive {
+		return c.attach(ctx, resp.ID, tty, func() {
+			started = true
+			release()
+		}, statusCh, errCh)
+	}
 
 	if err := c.dcli.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{}); err != nil {
 		return fmt.Errorf("failed start docker container: %s", err)
 	}
-
-	if tty {
-		// statusCh, errCh := c.dcli.ContainerWait(ctx, resp.ID, container.WaitConditionNotRunning)
-
-		// resp, err := c.dcli.ContainerAttach(ctx, resp.ID, types.ContainerAttachOptions{
-		// 	Stdin:  true,
-		// 	Stdout: true,
-		// 	//			Stderr: true,
-		// 	//			Stream: true,
-		// })
-		// if err != nil {
-		// 	return fmt.Errorf("failed attach to docker container: %s", err)
-		// }
-
-		// defer resp.Close()
-
-		// select {
-		// case err := <-errCh:
-		// 	if err != nil {
-		// 		return fmt.Errorf("failed start docker container: %s", err)
-		// 	}
-		// case status := <-statusCh:
-		// 	if status.StatusCode != 0 {
-		// 		return fmt.Errorf("container process failed: %s", status.Error.Message)
-		// 	}
-		// }
-
-		// stdcopy.StdCopy(os.Stdout, os.Stderr, session.Reader)
-
-		cmd := exec.Command("docker", "attach", resp.ID)
-		cmd.Stdin = os.Stdin
-		cmd.Stdout = os.Stdout
-		err := cmd.Run()
+	started = true
+	release()
+
+	logsCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	logsDone := make(chan struct{})
+	go func() {
+		defer close(logsDone)
+		out, err := c.dcli.ContainerLogs(logsCtx, resp.ID, types.ContainerLogsOptions{
+			ShowStdout: true, ShowStderr: true, Follow: true})
 		if err != nil {
-			return err
+			c.logger.Warnf("Failed to tail docker container logs: %s", err)
+			return
 		}
-	} else {
-		statusCh, errCh := c.dcli.ContainerWait(ctx, resp.ID, container.WaitConditionNotRunning)
-
-		ctx, cancel := context.WithCancel(ctx)
-		go func() {
-			out, err := c.dcli.ContainerLogs(ctx, resp.ID, types.ContainerLogsOptions{
-				ShowStdout: true, ShowStderr: true, Follow: true})
-			if err != nil {
-				c.logger.Printf("[warning] Failed to tail docker container logs: %s", err)
-			}
-
-			stdcopy.StdCopy(os.Stdout, os.Stderr, out)
-		}()
-
-		select {
-		case err := <-errCh:
-			if err != nil {
-				cancel()
-				return fmt.Errorf("failed start docker container: %s", err)
-			}
-		case status := <-statusCh:
-			cancel()
-			if status.StatusCode != 0 {
-				return fmt.Errorf("container process failed: %s", status.Error)
-			}
+		c.logContainerOutput(out)
+	}()
+
+	err = waitExit(ctx, statusCh, errCh)
+	select {
+	case <-logsDone:
+	case <-time.After(logsDrainTimeout):
+	}
+	return err
+}
+
+// logContainerOutput logs every line written by the container tagged with
+// source=bucc, to tell it apart from the messages of mc itself.
+func (c *Client) logContainerOutput(r io.Reader) {
+	l := c.logger.WithField("source", "bucc")
+	stdout := &lineLogger{log: l.WithField("stream", "stdout"), level: logrus.InfoLevel}
+	// errors of bosh and bucc stay visible with --log-level=warn
+	stderr := &lineLogger{log: l.WithField("stream", "stderr"), level: logrus.WarnLevel}
+	stdcopy.StdCopy(stdout, stderr, r)
+	stdout.flush()
+	stderr.flush()
+}
+
+// lineLogger logs each complete line written to it as a message at level.
+type lineLogger struct {
+	log   *logrus.Entry
+	level logrus.Level
+	buf   []byte
+}
+
+func (w *lineLogger) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			return len(p), nil
 		}
+		w.log.Log(w.level, strings.TrimRight(string(w.buf[:i]), "\r"))
+		w.buf = w.buf[i+1:]
 	}
+}
+
+func (w *lineLogger) flush() {
+	if len(w.buf) != 0 {
+		w.log.Log(w.level, string(w.buf))
+		w.buf = nil
+	}
+}
 
+// removeContainer stops and removes a container which is abandoned because
+// it failed to start, or mc got interrupted or timed out, so it uses a
+// context of its own.
+func (c *Client) removeContainer(id string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*containerStopTimeout)
+	defer cancel()
+
+	c.logger.Warnf("Stopping docker container %.12s", id)
+	timeout := containerStopTimeout
+	if err := c.dcli.ContainerStop(ctx, id, &timeout); err != nil {
+		c.logger.Debugf("Failed to stop docker container %.12s: %s", id, err)
+	}
+	// auto removal does not cover containers which never started
+	err := c.dcli.ContainerRemove(ctx, id, types.ContainerRemoveOptions{Force: true})
+	if err != nil && !client.IsErrNotFound(err) {
+		c.logger.Debugf("Failed to remove docker container %.12s: %s", id, err)
+	}
+}
+
+func waitExit(ctx context.Context, statusCh <-chan container.ContainerWaitOKBody, errCh <-chan error) error {
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("gave up waiting for docker container: %s", ctx.Err())
+	case err := <-errCh:
+		return fmt.Errorf("failed to wait for docker container: %s", err)
+	case status := <-statusCh:
+		if status.Error != nil {
+			return fmt.Errorf("failed to wait for docker container: %s", status.Error.Message)
+		}
+		if status.StatusCode != 0 {
+			return &ExitError{Code: int(status.StatusCode)}
+		}
+	}
 	return nil
 }
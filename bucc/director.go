@@ -0,0 +1,131 @@
+package bucc
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	directorRequestTimeout = 30 * time.Second
+	// tokens are refreshed a bit before they expire
+	tokenExpiryMargin = 30 * time.Second
+)
+
+// Director is a minimal client for the BOSH director API, authenticating
+// with UAA client credentials like the bosh cli.
+type Director struct {
+	target  BOSHTarget
+	http    *http.Client
+	token   string
+	expires time.Time
+}
+
+type Task struct {
+	ID          int    `json:"id"`
+	State       string `json:"state"`
+	Description string `json:"description"`
+}
+
+// Finished reports whether the task has stopped running.
+func (t Task) Finished() bool {
+	switch t.State {
+	case "done", "error", "cancelled", "timeout":
+		return true
+	}
+	return false
+}
+
+func NewDirector(t BOSHTarget) (*Director, error) {
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM([]byte(t.CACert)) {
+		return nil, fmt.Errorf("failed to parse director CA certificate")
+	}
+	return &Director{target: t, http: &http.Client{
+		Timeout:   directorRequestTimeout,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+	}}, nil
+}
+
+// Tasks returns the most recent tasks, newest first.
+func (d *Director) Tasks(ctx context.Context) ([]Task, error) {
+	if err := d.authorize(ctx); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodGet, d.target.Environment+"/tasks?verbose=1&limit=50", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+d.token)
+
+	var tasks []Task
+	if err = d.do(ctx, req, &tasks); err != nil {
+		return nil, fmt.Errorf("failed to list director tasks: %s", err)
+	}
+	return tasks, nil
+}
+
+// authorize fetches a token from the UAA the director delegates to.
+func (d *Director) authorize(ctx context.Context) error {
+	if d.token != "" && time.Now().Before(d.expires) {
+		return nil
+	}
+
+	req, err := http.NewRequest(http.MethodGet, d.target.Environment+"/info", nil)
+	if err != nil {
+		return err
+	}
+	var info struct {
+		UserAuthentication struct {
+			Type    string `json:"type"`
+			Options struct {
+				URL string `json:"url"`
+			} `json:"options"`
+		} `json:"user_authentication"`
+	}
+	if err = d.do(ctx, req, &info); err != nil {
+		return fmt.Errorf("failed to get director info: %s", err)
+	}
+	if info.UserAuthentication.Type != "uaa" {
+		return fmt.Errorf("director uses %s authentication, only uaa is supported", info.UserAuthentication.Type)
+	}
+
+	form := url.Values{"grant_type": {"client_credentials"}}
+	req, err = http.NewRequest(http.MethodPost, info.UserAuthentication.Options.URL+"/oauth/token",
+		strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(d.target.Client, d.target.ClientSecret)
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err = d.do(ctx, req, &token); err != nil {
+		return fmt.Errorf("failed to get UAA token: %s", err)
+	}
+	d.token = token.AccessToken
+	d.expires = time.Now().Add(time.Duration(token.ExpiresIn)*time.Second - tokenExpiryMargin)
+	return nil
+}
+
+func (d *Director) do(ctx context.Context, req *http.Request, v interface{}) error {
+	req.Header.Set("Accept", "application/json")
+	resp, err := d.http.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s %s returned %s", req.Method, req.URL.Path, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
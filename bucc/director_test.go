@@ -0,0 +1,91 @@
+package bucc_test
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/starkandwayne/molten-core/bucc"
+)
+
+var _ = Describe("Director", func() {
+	var (
+		server *httptest.Server
+		tokens int
+		d      *Director
+	)
+
+	BeforeEach(func() {
+		tokens = 0
+		mux := http.NewServeMux()
+		mux.HandleFunc("/info", func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"user_authentication": map[string]interface{}{
+					"type":    "uaa",
+					"options": map[string]string{"url": server.URL},
+				},
+			})
+		})
+		mux.HandleFunc("/oauth/token", func(w http.ResponseWriter, r *http.Request) {
+			client, secret, _ := r.BasicAuth()
+			if client != "admin" || secret != "secret" || r.FormValue("grant_type") != "client_credentials" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			tokens++
+			json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "token", "expires_in": 3600})
+		})
+		mux.HandleFunc("/tasks", func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`[{"id":12,"state":"processing","description":"create deployment"},
+				{"id":11,"state":"done","description":"delete deployment"}]`))
+		})
+		server = httptest.NewTLSServer(mux)
+
+		ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+		var err error
+		d, err = NewDirector(BOSHTarget{Environment: server.URL, CACert: string(ca),
+			Client: "admin", ClientSecret: "secret"})
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("lists tasks with a UAA token", func() {
+		tasks, err := d.Tasks(context.Background())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(tasks).To(Equal([]Task{
+			{ID: 12, State: "processing", Description: "create deployment"},
+			{ID: 11, State: "done", Description: "delete deployment"},
+		}))
+		Expect(tasks[0].Finished()).To(BeFalse())
+		Expect(tasks[1].Finished()).To(BeTrue())
+	})
+
+	It("reuses the token until it expires", func() {
+		for i := 0; i < 3; i++ {
+			_, err := d.Tasks(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+		}
+		Expect(tokens).To(Equal(1))
+	})
+
+	It("fails with wrong client credentials", func() {
+		d, err := NewDirector(BOSHTarget{Environment: server.URL,
+			CACert: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})),
+			Client: "admin", ClientSecret: "wrong"})
+		Expect(err).ToNot(HaveOccurred())
+		_, err = d.Tasks(context.Background())
+		Expect(err).To(MatchError(ContainSubstring("failed to get UAA token")))
+	})
+})
@@ -0,0 +1,8 @@
+package bucc
+
+var (
+	HelperIPs = helperIPs
+	FreeIP    = freeIP
+
+	NewlyFinished = newlyFinished
+)
@@ -0,0 +1,120 @@
+package bucc
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/docker/client"
+
+	"github.com/starkandwayne/molten-core/blobstore"
+	"github.com/starkandwayne/molten-core/util"
+)
+
+const (
+	buccImageRepository = "starkandwayne/mc-bucc"
+	deployedImageFile   = "mc-image"
+)
+
+var (
+	// buccImageDigest pins the BUCC image for an mc release, it is set at
+	// build time with: -ldflags "-X github.com/starkandwayne/molten-core/bucc.buccImageDigest=sha256:..."
+	buccImageDigest string
+)
+
+// DefaultImage returns the BUCC image pinned by this mc build,
+// development builds fall back to the latest tag.
+func DefaultImage() string {
+	if buccImageDigest == "" {
+		return buccImageRepository + ":latest"
+	}
+	return fmt.Sprintf("%s@%s", buccImageRepository, buccImageDigest)
+}
+
+func (c *Client) pullImage(ctx context.Context) error {
+	if c.offline() {
+		c.image = c.offlineImage()
+	}
+	err := util.RetryDocker(ctx, "docker to inspect "+c.image, func() error {
+		_, _, err := c.dcli.ImageInspectWithRaw(ctx, c.image)
+		return err
+	})
+	if err == nil {
+		return nil
+	}
+	if !client.IsErrNotFound(err) {
+		return fmt.Errorf("failed to inspect image %s: %s", c.image, err)
+	}
+	return c.fetchImage(ctx)
+}
+
+// fetchImage pulls (or loads when offline) the image, even if already present
+func (c *Client) fetchImage(ctx context.Context) error {
+	if c.offline() {
+		return c.loadImage(ctx)
+	}
+	return c.downloadImage(ctx)
+}
+
+func (c *Client) downloadImage(ctx context.Context) error {
+	c.logger.Infof("Pulling MoltenCore docker image %s, this can take a while", c.image)
+	return util.PullImage(ctx, c.dcli, c.logger, c.image, util.PullAuth{
+		ServerAddress: c.cluster.RegistryHost(),
+		Username:      c.registryAuth.Username,
+		Password:      c.registryAuth.Password,
+	})
+}
+
+// loadImage loads the BUCC image from the archive pinned in the offline config
+func (c *Client) loadImage(ctx context.Context) error {
+	archive := c.cluster.Offline.ImageArchive
+	c.logger.Infof("Loading MoltenCore docker image from %s", archive)
+	if err := blobstore.VerifyFile(archive, c.cluster.Offline.ImageArchiveSHA256); err != nil {
+		return fmt.Errorf("failed to verify image archive: %s", err)
+	}
+
+	f, err := os.Open(archive)
+	if err != nil {
+		return fmt.Errorf("failed to open image archive: %s", err)
+	}
+	defer f.Close()
+
+	if err = util.LoadImage(ctx, c.dcli, f, c.offlineImage()); err != nil {
+		return fmt.Errorf("failed to load image archive %s: %s", archive, err)
+	}
+	c.image = c.offlineImage()
+	return nil
+}
+
+// offline reports whether the image is loaded from the offline archive,
+// instead of being pulled.
+func (c *Client) offline() bool {
+	return c.cluster.Offline.Enabled && c.cluster.Registry == ""
+}
+
+// offlineImage is the reference the image loaded from the offline archive is
+// tagged with, the archive has been verified by its checksum instead.
+func (c *Client) offlineImage() string {
+	digest := strings.ToLower(strings.TrimPrefix(c.cluster.Offline.ImageArchiveSHA256, "sha256:"))
+	return fmt.Sprintf("%s:offline-%s", buccImageRepository, digest)
+}
+
+// deployedImage returns the image BUCC was last successfully deployed with.
+func deployedImage() (string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(buccHostStateDir, deployedImageFile))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	return strings.TrimSpace(string(data)), err
+}
+
+func (c *Client) writeDeployedImage() error {
+	err := ioutil.WriteFile(filepath.Join(buccHostStateDir, deployedImageFile), []byte(c.image+"\n"), 0644)
+	if err != nil {
+		return fmt.Errorf("failed to record deployed image: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package bucc
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+
+	"github.com/docker/docker/api/types"
+
+	"github.com/starkandwayne/molten-core/config"
+	"github.com/starkandwayne/molten-core/flannel"
+)
+
+const (
+	// host 1 is the gateway, the rest of the reserved range is not used by BOSH
+	firstReservedHost = 2
+	lastReservedHost  = numberOfReservedIPs + 1
+	ipamLockFile      = "/run/lock/mc-ipam.lock"
+)
+
+// ValidateIPHostIndex checks the director IP lies in the range reserved in
+// the cloud config, BOSH could hand it out to a deployment otherwise.
+func ValidateIPHostIndex(i int) error {
+	if i < firstReservedHost || i > lastReservedHost {
+		return fmt.Errorf("director ip host index %d is outside of the reserved range %d-%d",
+			i, firstReservedHost, lastReservedHost)
+	}
+	return nil
+}
+
+// helperIPs lists the reserved addresses which can be used by
+// helper containers, which is all of them except the director's.
+func helperIPs(s flannel.Subnet, director int) ([]net.IP, error) {
+	var ips []net.IP
+	for i := firstReservedHost; i <= lastReservedHost; i++ {
+		if i == director {
+			continue
+		}
+		ip, err := s.Host(i)
+		if err != nil {
+			return nil, err
+		}
+		ips = append(ips, ip)
+	}
+	return ips, nil
+}
+
+// freeIP returns the first candidate which is not in use.
+func freeIP(candidates []net.IP, used map[string]bool) (net.IP, error) {
+	for _, ip := range candidates {
+		if !used[ip.String()] {
+			return ip, nil
+		}
+	}
+	return nil, fmt.Errorf("all %d reserved ips are in use", len(candidates))
+}
+
+// allocateIP picks an unused address from the reserved range of the bosh
+// network. Only started containers show up in the network, so the returned
+// release func must be called once the container has been started.
+func (c *Client) allocateIP(ctx context.Context) (net.IP, func(), error) {
+	release, err := lockFile(ipamLockFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to lock %s: %s", ipamLockFile, err)
+	}
+
+	ip, err := c.unusedIP(ctx)
+	if err != nil {
+		release()
+		return nil, nil, err
+	}
+	return ip, release, nil
+}
+
+func (c *Client) unusedIP(ctx context.Context) (net.IP, error) {
+	candidates, err := helperIPs(c.config.Subnet, c.cluster.BUCC.IPHostIndex)
+	if err != nil {
+		return nil, fmt.Errorf("failed to determine reserved ips: %s", err)
+	}
+
+	res, err := c.dcli.NetworkInspect(ctx, config.BOSHDockerNetworkName, types.NetworkInspectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect docker network: %s", err)
+	}
+
+	used := make(map[string]bool)
+	for _, e := range res.Containers {
+		if ip, _, err := net.ParseCIDR(e.IPv4Address); err == nil {
+			used[ip.String()] = true
+		}
+	}
+
+	return freeIP(candidates, used)
+}
+
+// lockFile takes an exclusive lock on path, shared by all mc processes on
+// the node, until the returned func is called. Calling it again is a no-op.
+func lockFile(path string) (func(), error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	released := false
+	return func() {
+		if !released {
+			released = true
+			f.Close()
+		}
+	}, nil
+}
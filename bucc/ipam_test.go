@@ -0,0 +1,59 @@
+package bucc_test
+
+import (
+	"net"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	. "github.com/starkandwayne/molten-core/bucc"
+	"github.com/starkandwayne/molten-core/flannel"
+)
+
+var _ = Describe("IPAM", func() {
+	DescribeTable("ValidateIPHostIndex",
+		func(i int, valid bool) {
+			err := ValidateIPHostIndex(i)
+			if valid {
+				Expect(err).ToNot(HaveOccurred())
+			} else {
+				Expect(err).To(MatchError(ContainSubstring("outside of the reserved range 2-20")))
+			}
+		},
+		Entry("gateway", 1, false),
+		Entry("first reserved host", 2, true),
+		Entry("last reserved host", 20, true),
+		Entry("first host handed out by BOSH", 21, false),
+	)
+
+	It("lists the reserved ips except the director's", func() {
+		s, err := flannel.GetSubnetByIndex(0)
+		Expect(err).ToNot(HaveOccurred())
+
+		ips, err := HelperIPs(s, 2)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ips).To(HaveLen(18))
+		Expect(ips[0].String()).To(Equal("10.1.1.3"))
+		Expect(ips[len(ips)-1].String()).To(Equal("10.1.1.20"))
+	})
+
+	Describe("FreeIP", func() {
+		candidates := []net.IP{net.ParseIP("10.1.1.3"), net.ParseIP("10.1.1.4")}
+
+		DescribeTable("picks the first unused candidate",
+			func(used map[string]bool, expected string) {
+				ip, err := FreeIP(candidates, used)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(ip.String()).To(Equal(expected))
+			},
+			Entry("none used", map[string]bool{}, "10.1.1.3"),
+			Entry("first used", map[string]bool{"10.1.1.3": true}, "10.1.1.4"),
+		)
+
+		It("fails when all candidates are in use", func() {
+			_, err := FreeIP(candidates, map[string]bool{"10.1.1.3": true, "10.1.1.4": true})
+			Expect(err).To(MatchError("all 2 reserved ips are in use"))
+		})
+	})
+})
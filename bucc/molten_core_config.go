@@ -8,13 +8,28 @@ import (
 	"github.com/starkandwayne/molten-core/config"
 )
 
+const (
+	// capacity set aside for the BUCC container on the singleton zone
+	buccReservedCPUs     = 2
+	buccReservedMemoryMB = 8192
+)
+
 var (
 	allSizes = []int{1, 2, 4, 8, 16, 32, 64}
 )
 
 type moltenCoreConfig struct {
-	PublicIPs map[string]string `json:"public_ips"`
-	Scaling   scaling           `json:"scaling"`
+	PublicIPs    map[string]string `json:"public_ips"`
+	BUCC         buccEndpoints     `json:"bucc"`
+	Scaling      scaling           `json:"scaling"`
+	BlobstoreURL string            `json:"blobstore_url,omitempty"`
+}
+
+type buccEndpoints struct {
+	DirectorName string `json:"director_name"`
+	Alias        string `json:"alias"`
+	ConcourseURL string `json:"concourse_url"`
+	UAAURL       string `json:"uaa_url"`
 }
 
 type scaling struct {
@@ -31,16 +46,26 @@ type azsAndInstances struct {
 	Instances int      `json:"instances"`
 }
 
-func RenderMoltenCoreConfig(confs *[]config.NodeConfig) (string, error) {
+func RenderMoltenCoreConfig(confs *[]config.NodeConfig, cc *config.ClusterConfig) (string, error) {
 	var mcconf moltenCoreConfig
 
-	azs := make([]string, 0)
 	mcconf.PublicIPs = make(map[string]string)
 	for _, conf := range *confs {
 		mcconf.PublicIPs[conf.Zone()] = conf.PublicIP.String()
-		azs = append(azs, conf.Zone())
+		if !conf.IsSingletonZone() {
+			continue
+		}
+		mcconf.BUCC = buccEndpoints{
+			DirectorName: cc.BUCC.DirectorName,
+			Alias:        cc.BUCC.Alias,
+			ConcourseURL: fmt.Sprintf("https://%s:%d", conf.PublicIP, cc.BUCC.ConcoursePort),
+			UAAURL:       fmt.Sprintf("https://%s:%d", conf.PublicIP, cc.BUCC.UAAPort),
+		}
+		if cc.Offline.Enabled {
+			mcconf.BlobstoreURL = cc.BlobstoreURL(conf)
+		}
 	}
-	sort.Strings(azs)
+	azs := rankAZs(*confs)
 
 	mcconf.Scaling.All = make(map[string]azsAndInstances)
 	for _, size := range allSizes {
@@ -81,6 +106,60 @@ func RenderMoltenCoreConfig(confs *[]config.NodeConfig) (string, error) {
 	return string(raw), nil
 }
 
+// rankAZs orders the azs by the capacity left for BOSH deployments, so the
+// first slices land on the least loaded nodes. The azs keep their name order
+// until the capacity of every node is known, node configs written by older
+// mc releases do not have one.
+func rankAZs(confs []config.NodeConfig) []string {
+	ranked := make([]config.NodeConfig, len(confs))
+	copy(ranked, confs)
+	sort.Slice(ranked, func(i, j int) bool {
+		return ranked[i].Zone() < ranked[j].Zone()
+	})
+
+	known := true
+	for _, conf := range ranked {
+		known = known && conf.Capacity.Known()
+	}
+	if !known {
+		return zones(ranked)
+	}
+
+	available := func(conf config.NodeConfig) config.Capacity {
+		c := conf.Capacity
+		if c.Known() && conf.IsSingletonZone() {
+			c.CPUs = reserve(c.CPUs, buccReservedCPUs)
+			c.MemoryMB = reserve(c.MemoryMB, buccReservedMemoryMB)
+		}
+		return c
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool {
+		a, b := available(ranked[i]), available(ranked[j])
+		if a.MemoryMB != b.MemoryMB {
+			return a.MemoryMB > b.MemoryMB
+		}
+		return a.CPUs > b.CPUs
+	})
+
+	return zones(ranked)
+}
+
+func zones(confs []config.NodeConfig) []string {
+	azs := make([]string, 0)
+	for _, conf := range confs {
+		azs = append(azs, conf.Zone())
+	}
+	return azs
+}
+
+func reserve(total, reserved int) int {
+	if total < reserved {
+		return 0
+	}
+	return total - reserved
+}
+
 func slice(azs []string, size int, slices int) map[string]azsAndInstances {
 	out := make(map[string]azsAndInstances)
 
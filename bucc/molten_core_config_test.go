@@ -21,6 +21,12 @@ func node(i int) config.NodeConfig {
 	}
 }
 
+func nodeWithCapacity(i, cpus, memoryMB int) config.NodeConfig {
+	n := node(i)
+	n.Capacity = config.Capacity{CPUs: cpus, MemoryMB: memoryMB}
+	return n
+}
+
 func cluster(s int) []config.NodeConfig {
 	nodes := make([]config.NodeConfig, 0)
 	for i := 0; i < s; i++ {
@@ -32,14 +38,22 @@ func cluster(s int) []config.NodeConfig {
 }
 
 var _ = Describe("MoltenCoreConfig", func() {
+	cc := config.DefaultClusterConfig()
+
 	Context("given a 1 node cluster", func() {
 		It("renders config", func() {
 			nodes := cluster(1)
-			out, err := RenderMoltenCoreConfig(&nodes)
+			out, err := RenderMoltenCoreConfig(&nodes, &cc)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(out).Should(MatchJSON(`
 {
   "public_ips": { "z0": "192.168.2.10" },
+  "bucc": {
+    "director_name": "moltencore",
+    "alias": "mc",
+    "concourse_url": "https://192.168.2.10:1443",
+    "uaa_url": "https://192.168.2.10:1444"
+  },
   "scaling": {
     "odd3": {
       "slice1": { "azs": [ "z0" ], "instances": 1 },
@@ -83,7 +97,7 @@ var _ = Describe("MoltenCoreConfig", func() {
 	Context("given a 2 node cluster", func() {
 		It("renders config", func() {
 			nodes := cluster(2)
-			out, err := RenderMoltenCoreConfig(&nodes)
+			out, err := RenderMoltenCoreConfig(&nodes, &cc)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(out).Should(MatchJSON(`
 {
@@ -91,6 +105,12 @@ var _ = Describe("MoltenCoreConfig", func() {
     "z0": "192.168.2.10",
     "z1": "192.168.2.11"
   },
+  "bucc": {
+    "director_name": "moltencore",
+    "alias": "mc",
+    "concourse_url": "https://192.168.2.10:1443",
+    "uaa_url": "https://192.168.2.10:1444"
+  },
   "scaling": {
     "odd3": {
       "slice1": { "azs": [ "z0" ], "instances": 1 },
@@ -134,7 +154,7 @@ var _ = Describe("MoltenCoreConfig", func() {
 	Context("given a 3 node cluster", func() {
 		It("renders config", func() {
 			nodes := cluster(3)
-			out, err := RenderMoltenCoreConfig(&nodes)
+			out, err := RenderMoltenCoreConfig(&nodes, &cc)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(out).Should(MatchJSON(`
 {
@@ -143,6 +163,12 @@ var _ = Describe("MoltenCoreConfig", func() {
     "z1": "192.168.2.11",
     "z2": "192.168.2.12"
   },
+  "bucc": {
+    "director_name": "moltencore",
+    "alias": "mc",
+    "concourse_url": "https://192.168.2.10:1443",
+    "uaa_url": "https://192.168.2.10:1444"
+  },
   "scaling": {
     "odd3": {
       "slice1": { "azs": [ "z0", "z1", "z2" ], "instances": 3 },
@@ -186,7 +212,7 @@ var _ = Describe("MoltenCoreConfig", func() {
 	Context("given a 5 node cluster", func() {
 		It("renders config", func() {
 			nodes := cluster(5)
-			out, err := RenderMoltenCoreConfig(&nodes)
+			out, err := RenderMoltenCoreConfig(&nodes, &cc)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(out).Should(MatchJSON(`
 {
@@ -197,6 +223,12 @@ var _ = Describe("MoltenCoreConfig", func() {
     "z3": "192.168.2.13",
     "z4": "192.168.2.14"
   },
+  "bucc": {
+    "director_name": "moltencore",
+    "alias": "mc",
+    "concourse_url": "https://192.168.2.10:1443",
+    "uaa_url": "https://192.168.2.10:1444"
+  },
   "scaling": {
     "odd3": {
       "slice1": { "azs": [ "z0", "z1", "z2" ], "instances": 3 },
@@ -240,7 +272,7 @@ var _ = Describe("MoltenCoreConfig", func() {
 	Context("given a 9 node cluster", func() {
 		It("renders config", func() {
 			nodes := cluster(9)
-			out, err := RenderMoltenCoreConfig(&nodes)
+			out, err := RenderMoltenCoreConfig(&nodes, &cc)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(out).Should(MatchJSON(`
 {
@@ -255,6 +287,12 @@ var _ = Describe("MoltenCoreConfig", func() {
     "z7": "192.168.2.17",
     "z8": "192.168.2.18"
   },
+  "bucc": {
+    "director_name": "moltencore",
+    "alias": "mc",
+    "concourse_url": "https://192.168.2.10:1443",
+    "uaa_url": "https://192.168.2.10:1444"
+  },
   "scaling": {
     "odd3": {
       "slice1": { "azs": [ "z0", "z1", "z2" ], "instances": 3 },
@@ -291,6 +329,148 @@ var _ = Describe("MoltenCoreConfig", func() {
     }
   }
 }
+`))
+		})
+	})
+
+	Context("given a 3 node cluster with equal capacity", func() {
+		It("moves the BUCC zone to the back of each slice", func() {
+			nodes := []config.NodeConfig{
+				nodeWithCapacity(0, 16, 65536),
+				nodeWithCapacity(1, 16, 65536),
+				nodeWithCapacity(2, 16, 65536),
+			}
+			out, err := RenderMoltenCoreConfig(&nodes, &cc)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(out).Should(MatchJSON(`
+{
+  "public_ips": {
+    "z0": "192.168.2.10",
+    "z1": "192.168.2.11",
+    "z2": "192.168.2.12"
+  },
+  "bucc": {
+    "director_name": "moltencore",
+    "alias": "mc",
+    "concourse_url": "https://192.168.2.10:1443",
+    "uaa_url": "https://192.168.2.10:1444"
+  },
+  "scaling": {
+    "odd3": {
+      "slice1": { "azs": [ "z1", "z2", "z0" ], "instances": 3 },
+      "slice2": { "azs": [ "z1", "z2", "z0" ], "instances": 3 },
+      "slice3": { "azs": [ "z1", "z2", "z0" ], "instances": 3 }
+    },
+    "odd5": {
+      "slice1": { "azs": [ "z1", "z2", "z0" ], "instances": 3 },
+      "slice2": { "azs": [ "z1", "z2", "z0" ], "instances": 3 }
+    },
+    "max1": {
+      "slice1": { "azs": [ "z1" ], "instances": 1 }
+    },
+    "max2": {
+      "slice1": { "azs": [ "z1", "z2" ], "instances": 2 },
+      "slice2": { "azs": [ "z1", "z2" ], "instances": 2 },
+      "slice3": { "azs": [ "z1", "z2" ], "instances": 2 },
+      "slice4": { "azs": [ "z1", "z2" ], "instances": 2 },
+      "slice5": { "azs": [ "z1", "z2" ], "instances": 2 }
+    },
+    "max3": {
+      "slice1": { "azs": [ "z1", "z2", "z0" ], "instances": 3 },
+      "slice2": { "azs": [ "z1", "z2", "z0" ], "instances": 3 },
+      "slice3": { "azs": [ "z1", "z2", "z0" ], "instances": 3 }
+    },
+    "all": {
+      "x1": { "azs": [ "z1", "z2", "z0" ], "instances": 3 },
+      "x2": { "azs": [ "z1", "z2", "z0" ], "instances": 6 },
+      "x4": { "azs": [ "z1", "z2", "z0" ], "instances": 12 },
+      "x8": { "azs": [ "z1", "z2", "z0" ], "instances": 24 },
+      "x16": { "azs": [ "z1", "z2", "z0" ], "instances": 48 },
+      "x32": { "azs": [ "z1", "z2", "z0" ], "instances": 96 },
+      "x64": { "azs": [ "z1", "z2", "z0" ], "instances": 192 }
+    }
+  }
+}
+`))
+		})
+	})
+
+	Context("given a cluster with known and unknown capacities", func() {
+		It("keeps the name order of the azs", func() {
+			nodes := []config.NodeConfig{
+				nodeWithCapacity(2, 32, 131072),
+				node(1),
+				nodeWithCapacity(0, 16, 65536),
+			}
+			out, err := RenderMoltenCoreConfig(&nodes, &cc)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(out).To(ContainSubstring(`"max1":{"slice1":{"azs":["z0"],"instances":1}}`))
+			Expect(out).To(ContainSubstring(`"x1":{"azs":["z0","z1","z2"],"instances":3}`))
+		})
+	})
+
+	Context("given a 5 node cluster with mixed capacity", func() {
+		It("orders the azs by available capacity", func() {
+			nodes := []config.NodeConfig{
+				nodeWithCapacity(0, 16, 65536),
+				nodeWithCapacity(1, 8, 32768),
+				nodeWithCapacity(2, 16, 65536),
+				nodeWithCapacity(3, 32, 65536),
+				nodeWithCapacity(4, 8, 32768),
+			}
+			out, err := RenderMoltenCoreConfig(&nodes, &cc)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(out).Should(MatchJSON(`
+{
+  "public_ips": {
+    "z0": "192.168.2.10",
+    "z1": "192.168.2.11",
+    "z2": "192.168.2.12",
+    "z3": "192.168.2.13",
+    "z4": "192.168.2.14"
+  },
+  "bucc": {
+    "director_name": "moltencore",
+    "alias": "mc",
+    "concourse_url": "https://192.168.2.10:1443",
+    "uaa_url": "https://192.168.2.10:1444"
+  },
+  "scaling": {
+    "odd3": {
+      "slice1": { "azs": [ "z3", "z2", "z0" ], "instances": 3 },
+      "slice2": { "azs": [ "z3", "z2", "z0" ], "instances": 3 },
+      "slice3": { "azs": [ "z3", "z2", "z0" ], "instances": 3 }
+    },
+    "odd5": {
+      "slice1": { "azs": [ "z3", "z2", "z0", "z1", "z4" ], "instances": 5 },
+      "slice2": { "azs": [ "z3", "z2", "z0", "z1", "z4" ], "instances": 5 }
+    },
+    "max1": {
+      "slice1": { "azs": [ "z3" ], "instances": 1 }
+    },
+    "max2": {
+      "slice1": { "azs": [ "z3", "z2" ], "instances": 2 },
+      "slice2": { "azs": [ "z0", "z1" ], "instances": 2 },
+      "slice3": { "azs": [ "z3", "z2" ], "instances": 2 },
+      "slice4": { "azs": [ "z3", "z2" ], "instances": 2 },
+      "slice5": { "azs": [ "z3", "z2" ], "instances": 2 }
+    },
+    "max3": {
+      "slice1": { "azs": [ "z3", "z2", "z0" ], "instances": 3 },
+      "slice2": { "azs": [ "z3", "z2", "z0" ], "instances": 3 },
+      "slice3": { "azs": [ "z3", "z2", "z0" ], "instances": 3 }
+    },
+    "all": {
+      "x1": { "azs": [ "z3", "z2", "z0", "z1", "z4" ], "instances": 5 },
+      "x2": { "azs": [ "z3", "z2", "z0", "z1", "z4" ], "instances": 10 },
+      "x4": { "azs": [ "z3", "z2", "z0", "z1", "z4" ], "instances": 20 },
+      "x8": { "azs": [ "z3", "z2", "z0", "z1", "z4" ], "instances": 40 },
+      "x16": { "azs": [ "z3", "z2", "z0", "z1", "z4" ], "instances": 80 },
+      "x32": { "azs": [ "z3", "z2", "z0", "z1", "z4" ], "instances": 160 },
+      "x64": { "azs": [ "z3", "z2", "z0", "z1", "z4" ], "instances": 320 }
+    }
+  }
+}
 `))
 		})
 	})
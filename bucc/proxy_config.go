@@ -0,0 +1,69 @@
+package bucc
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/starkandwayne/molten-core/config"
+)
+
+const (
+	// caddy reads its config from /etc/caddy, the proxy dir is mounted there
+	proxyContainerDir = "/etc/caddy"
+	ProxyCertFile     = "cert.pem"
+	ProxyKeyFile      = "key.pem"
+	ProxyACMECAFile   = "acme-ca.pem"
+)
+
+// ProxyTLS tells which files in the proxy dir have been supplied by the
+// operator. Without a certificate caddy obtains one via ACME per hostname.
+type ProxyTLS struct {
+	Certificate bool
+	ACMECARoot  bool
+}
+
+// RenderProxyConfig renders the Caddyfile routing the subdomains of the
+// proxy domain to the BUCC components. Concourse and UAA are bound to the
+// public IP of the BUCC node, CredHub is only reachable on the bosh network.
+// All of them use self-signed certificates.
+func RenderProxyConfig(conf *config.NodeConfig, cc config.ClusterConfig, t ProxyTLS) (string, error) {
+	v, err := newVars(conf, cc.BUCC)
+	if err != nil {
+		return "", err
+	}
+
+	var b bytes.Buffer
+	if !t.Certificate {
+		b.WriteString("{\n")
+		if cc.Proxy.ACMEEmail != "" {
+			fmt.Fprintf(&b, "\temail %s\n", cc.Proxy.ACMEEmail)
+		}
+		if cc.Proxy.ACMECA != "" {
+			fmt.Fprintf(&b, "\tacme_ca %s\n", cc.Proxy.ACMECA)
+		}
+		if t.ACMECARoot {
+			fmt.Fprintf(&b, "\tacme_ca_root %s/%s\n", proxyContainerDir, ProxyACMECAFile)
+		}
+		b.WriteString("}\n")
+	}
+
+	routes := []struct {
+		name, host, port string
+	}{
+		{"concourse", v.HostIP, v.ConcourseHostPort},
+		{"uaa", v.HostIP, v.UAAHostPort},
+		{"credhub", v.InternalIP, strconv.Itoa(credhubPort)},
+	}
+	for _, r := range routes {
+		fmt.Fprintf(&b, "\n%s.%s {\n", r.name, cc.Proxy.Domain)
+		if t.Certificate {
+			fmt.Fprintf(&b, "\ttls %s/%s %s/%s\n",
+				proxyContainerDir, ProxyCertFile, proxyContainerDir, ProxyKeyFile)
+		}
+		fmt.Fprintf(&b, "\treverse_proxy https://%s {\n", net.JoinHostPort(r.host, r.port))
+		b.WriteString("\t\ttransport http {\n\t\t\ttls_insecure_skip_verify\n\t\t}\n\t}\n}\n")
+	}
+	return b.String(), nil
+}
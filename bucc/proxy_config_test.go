@@ -0,0 +1,51 @@
+package bucc_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/starkandwayne/molten-core/bucc"
+	"github.com/starkandwayne/molten-core/config"
+	"github.com/starkandwayne/molten-core/flannel"
+)
+
+var _ = Describe("ProxyConfig", func() {
+	var (
+		conf config.NodeConfig
+		cc   config.ClusterConfig
+	)
+
+	BeforeEach(func() {
+		conf = node(0)
+		var err error
+		conf.Subnet, err = flannel.GetSubnetByIndex(0)
+		Expect(err).ToNot(HaveOccurred())
+
+		cc = config.DefaultClusterConfig()
+		cc.Proxy.Domain = "mc.example.com"
+	})
+
+	It("routes the subdomains to the BUCC components", func() {
+		out, err := RenderProxyConfig(&conf, cc, ProxyTLS{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(out).To(ContainSubstring("concourse.mc.example.com {\n\treverse_proxy https://192.168.2.10:1443 {"))
+		Expect(out).To(ContainSubstring("uaa.mc.example.com {\n\treverse_proxy https://192.168.2.10:1444 {"))
+		Expect(out).To(ContainSubstring("credhub.mc.example.com {\n\treverse_proxy https://10.1.1.10:8844 {"))
+	})
+
+	It("configures the ACME server", func() {
+		cc.Proxy.ACMEEmail = "ops@example.com"
+		cc.Proxy.ACMECA = "https://pebble:14000/dir"
+		out, err := RenderProxyConfig(&conf, cc, ProxyTLS{ACMECARoot: true})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(out).To(HavePrefix("{\n\temail ops@example.com\n\tacme_ca https://pebble:14000/dir\n\tacme_ca_root /etc/caddy/acme-ca.pem\n}\n"))
+		Expect(out).ToNot(ContainSubstring("\ttls "))
+	})
+
+	It("uses the operator supplied certificate", func() {
+		out, err := RenderProxyConfig(&conf, cc, ProxyTLS{Certificate: true})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(out).ToNot(ContainSubstring("acme"))
+		Expect(out).To(ContainSubstring("\ttls /etc/caddy/cert.pem /etc/caddy/key.pem\n"))
+	})
+})
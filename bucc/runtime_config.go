@@ -1,7 +1,14 @@
 package bucc
 
 import (
-	"strings"
+	"encoding/json"
+	"fmt"
+
+	"github.com/starkandwayne/molten-core/config"
+)
+
+var (
+	defaultDNSRecursors = []string{"8.8.8.8", "8.8.4.4"}
 )
 
 const (
@@ -34,10 +41,7 @@ const (
             "cache": {
               "enabled": true
             },
-            "recursors": [
-              "8.8.8.8",
-              "8.8.4.4"
-            ],
+            "recursors": %s,
             "health": {
               "client": {
                 "tls": "((/dns_healthcheck_client_tls))"
@@ -102,12 +106,7 @@ const (
     }
   ],
   "releases": [
-    {
-      "name": "bosh-dns",
-      "sha1": "d514ab3ae376778e106e17c22b78a8705690ae1d",
-      "url": "https://bosh.io/d/github.com/cloudfoundry/bosh-dns-release?v=1.17.0",
-      "version": "1.17.0"
-    }
+    %s
   ],
   "variables": [
     {
@@ -175,7 +174,57 @@ const (
 `
 )
 
-func renderRuntimeConfig() string {
-	raw := strings.ReplaceAll(rcTmpl, "\n", "")
-	return raw
+type release struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	URL     string `json:"url"`
+	SHA1    string `json:"sha1"`
+}
+
+type runtimeConfig struct {
+	Addons    []json.RawMessage `json:"addons"`
+	Releases  []json.RawMessage `json:"releases"`
+	Variables []json.RawMessage `json:"variables"`
+}
+
+// RenderRuntimeConfig renders the bosh-dns runtime config merged with the
+// operator supplied addons. The recursors configured for the cluster take
+// precedence over the given (host) recursors.
+func RenderRuntimeConfig(rc config.RuntimeConfig, recursors []string) (string, error) {
+	if len(rc.DNSRecursors) != 0 {
+		recursors = rc.DNSRecursors
+	}
+	if len(recursors) == 0 {
+		recursors = defaultDNSRecursors
+	}
+
+	recursorsRaw, err := json.Marshal(recursors)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal recursors: %s", err)
+	}
+	releaseRaw, err := json.Marshal(release{
+		Name:    rc.BOSHDNS.Name,
+		Version: rc.BOSHDNS.Version,
+		URL:     rc.BOSHDNS.URL,
+		SHA1:    rc.BOSHDNS.SHA1,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal bosh-dns release: %s", err)
+	}
+
+	var out runtimeConfig
+	err = json.Unmarshal([]byte(fmt.Sprintf(rcTmpl, recursorsRaw, releaseRaw)), &out)
+	if err != nil {
+		return "", fmt.Errorf("failed to unmarshal runtime config template: %s", err)
+	}
+
+	out.Addons = append(out.Addons, rc.Addons...)
+	out.Releases = append(out.Releases, rc.Releases...)
+	out.Variables = append(out.Variables, rc.Variables...)
+
+	raw, err := json.Marshal(out)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal runtime config: %s", err)
+	}
+	return string(raw), nil
 }
@@ -0,0 +1,98 @@
+package bucc_test
+
+import (
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/starkandwayne/molten-core/bucc"
+	"github.com/starkandwayne/molten-core/config"
+)
+
+type renderedRuntimeConfig struct {
+	Addons []struct {
+		Name string `json:"name"`
+		Jobs []struct {
+			Properties struct {
+				Recursors []string `json:"recursors"`
+			} `json:"properties"`
+		} `json:"jobs"`
+	} `json:"addons"`
+	Releases []struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+		URL     string `json:"url"`
+	} `json:"releases"`
+	Variables []json.RawMessage `json:"variables"`
+}
+
+func renderRuntimeConfig(rc config.RuntimeConfig, recursors []string) renderedRuntimeConfig {
+	out, err := RenderRuntimeConfig(rc, recursors)
+	Expect(err).ToNot(HaveOccurred())
+
+	var parsed renderedRuntimeConfig
+	Expect(json.Unmarshal([]byte(out), &parsed)).ToNot(HaveOccurred())
+	return parsed
+}
+
+var _ = Describe("RuntimeConfig", func() {
+	var rc config.RuntimeConfig
+
+	BeforeEach(func() {
+		rc = config.DefaultClusterConfig().Runtime
+	})
+
+	It("renders the default bosh-dns release", func() {
+		out := renderRuntimeConfig(rc, nil)
+		Expect(out.Addons).To(HaveLen(2))
+		Expect(out.Addons[0].Jobs[0].Properties.Recursors).To(Equal([]string{"8.8.8.8", "8.8.4.4"}))
+		Expect(out.Releases).To(HaveLen(1))
+		Expect(out.Releases[0].Version).To(Equal("1.17.0"))
+		Expect(out.Variables).To(HaveLen(6))
+	})
+
+	It("uses the host recursors", func() {
+		out := renderRuntimeConfig(rc, []string{"10.0.0.2"})
+		Expect(out.Addons[0].Jobs[0].Properties.Recursors).To(Equal([]string{"10.0.0.2"}))
+	})
+
+	It("prefers the cluster recursors over the host recursors", func() {
+		rc.DNSRecursors = []string{"10.0.0.3", "10.0.0.4"}
+		out := renderRuntimeConfig(rc, []string{"10.0.0.2"})
+		Expect(out.Addons[0].Jobs[0].Properties.Recursors).To(Equal([]string{"10.0.0.3", "10.0.0.4"}))
+	})
+
+	It("uses the configured bosh-dns release", func() {
+		rc.BOSHDNS.Version = "1.18.0"
+		rc.BOSHDNS.URL = "http://blobstore.internal/bosh-dns-1.18.0.tgz"
+		out := renderRuntimeConfig(rc, nil)
+		Expect(out.Releases[0].Version).To(Equal("1.18.0"))
+		Expect(out.Releases[0].URL).To(Equal("http://blobstore.internal/bosh-dns-1.18.0.tgz"))
+	})
+
+	It("merges operator supplied addons", func() {
+		Expect(rc.AddAddons([]byte(`
+addons:
+- name: node-exporter
+  jobs:
+  - name: node_exporter
+    release: node-exporter
+releases:
+- name: node-exporter
+  version: 4.2.0
+  url: http://blobstore.internal/node-exporter-4.2.0.tgz
+`))).ToNot(HaveOccurred())
+
+		out := renderRuntimeConfig(rc, nil)
+		Expect(out.Addons).To(HaveLen(3))
+		Expect(out.Addons[2].Name).To(Equal("node-exporter"))
+		Expect(out.Releases).To(HaveLen(2))
+		Expect(out.Releases[1].Name).To(Equal("node-exporter"))
+		Expect(out.Variables).To(HaveLen(6))
+	})
+
+	It("rejects fragments without addons", func() {
+		Expect(rc.AddAddons([]byte(`releases: []`))).To(HaveOccurred())
+	})
+})
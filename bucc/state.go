@@ -0,0 +1,72 @@
+package bucc
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/starkandwayne/molten-core/config"
+)
+
+const (
+	varsFile  = "vars.yml"
+	credsFile = "creds.yml"
+)
+
+// SaveState stores the vars and the client creds from the state dir in
+// etcd, so BUCC can be used from all nodes. etcd does not require auth, so
+// private keys and other creds stay on the BUCC node.
+func (c *Client) SaveState(ctx context.Context) error {
+	vars, err := ioutil.ReadFile(filepath.Join(buccHostStateDir, varsFile))
+	if err != nil {
+		return fmt.Errorf("failed to read vars: %s", err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(buccHostStateDir, credsFile))
+	if err != nil {
+		return fmt.Errorf("failed to read creds: %s", err)
+	}
+	var cc creds
+	if err = yaml.Unmarshal(data, &cc); err != nil {
+		return fmt.Errorf("failed to unmarshal creds: %s", err)
+	}
+	clientCreds, err := yaml.Marshal(cc)
+	if err != nil {
+		return fmt.Errorf("failed to marshal client creds: %s", err)
+	}
+
+	s := config.BUCCState{Host: c.config.PrivateIP, Vars: vars, Creds: clientCreds}
+	return s.Save(ctx)
+}
+
+// UseClusterState points the client at the BUCC state stored in etcd,
+// for using BUCC from a node which is not hosting it. The returned
+// func removes the temporary state dir.
+func (c *Client) UseClusterState(ctx context.Context) (func(), error) {
+	s, err := config.LoadBUCCState(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.logger.Infof("Using BUCC running on %s", s.Host)
+
+	dir, err := ioutil.TempDir("", "mc-bucc-state")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create state dir: %s", err)
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+
+	if err = ioutil.WriteFile(filepath.Join(dir, varsFile), s.Vars, 0600); err != nil {
+		cleanup()
+		return nil, fmt.Errorf("failed to write vars: %s", err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(dir, credsFile), s.Creds, 0600); err != nil {
+		cleanup()
+		return nil, fmt.Errorf("failed to write creds: %s", err)
+	}
+
+	c.stateDir = dir
+	return cleanup, nil
+}
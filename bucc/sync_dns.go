@@ -0,0 +1,204 @@
+package bucc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+
+	"github.com/starkandwayne/molten-core/config"
+)
+
+const (
+	directorStateFile = "state.json"
+	syncDNSCommand    = "/var/vcap/jobs/director/bin/trigger-one-time-sync-dns"
+	// changes often come in bursts, e.g. during a deploy
+	syncDNSDelay      = 5 * time.Second
+	tasksPollInterval = 15 * time.Second
+	eventsRetryDelay  = 10 * time.Second
+)
+
+// SyncDNS triggers a one time sync of bosh-dns whenever instances are
+// attached to or detached from the bosh network, or a director task has
+// finished. Workaround for https://github.com/cloudfoundry/bosh/issues/2103
+func (c *Client) SyncDNS(ctx context.Context, d *Director) error {
+	changes := make(chan string, 1)
+	notify := func(reason string) {
+		select {
+		case changes <- reason:
+		default:
+		}
+	}
+	go c.watchNetwork(ctx, notify)
+	go c.watchTasks(ctx, d, notify)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case reason := <-changes:
+			c.logger.Debugf("Instances changed: %s", reason)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(syncDNSDelay):
+		}
+		select {
+		case <-changes:
+		default:
+		}
+
+		if err := c.triggerSyncDNS(ctx); err != nil {
+			c.logger.Warnf("Failed to sync bosh-dns: %s", err)
+		}
+	}
+}
+
+// watchNetwork notifies about containers being connected to or disconnected
+// from the bosh network, reconnecting when the event stream breaks.
+func (c *Client) watchNetwork(ctx context.Context, notify func(string)) {
+	opts := types.EventsOptions{Filters: filters.NewArgs(
+		filters.Arg("type", "network"),
+		filters.Arg("network", config.BOSHDockerNetworkName),
+	)}
+	for {
+		msgs, errs := c.dcli.Events(ctx, opts)
+	events:
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg := <-msgs:
+				if msg.Action == "connect" || msg.Action == "disconnect" {
+					notify(fmt.Sprintf("container %s %sed", msg.Actor.Attributes["container"], msg.Action))
+				}
+			case err := <-errs:
+				c.logger.Warnf("Docker event stream failed, retrying in %s: %s", eventsRetryDelay, err)
+				break events
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(eventsRetryDelay):
+		}
+		// events may have been missed in the meantime
+		notify("reconnected to docker events")
+	}
+}
+
+// watchTasks polls the director and notifies about tasks which have finished
+// since the first poll.
+func (c *Client) watchTasks(ctx context.Context, d *Director, notify func(string)) {
+	var reported map[int]bool
+	for {
+		tasks, err := d.Tasks(ctx)
+		if err != nil {
+			c.logger.Warnf("Failed to list director tasks: %s", err)
+		} else {
+			var finished []Task
+			finished, reported = newlyFinished(tasks, reported)
+			for _, t := range finished {
+				notify(fmt.Sprintf("task %d (%s) %s", t.ID, t.Description, t.State))
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(tasksPollInterval):
+		}
+	}
+}
+
+// newlyFinished returns the finished tasks which are not in reported, and the
+// finished tasks to compare the next poll with. Tasks do not finish in the
+// order of their IDs, e.g. a long deploy finishes after later short tasks.
+// Without reported, e.g. on the first poll, no task is returned.
+func newlyFinished(tasks []Task, reported map[int]bool) ([]Task, map[int]bool) {
+	var finished []Task
+	seen := make(map[int]bool)
+	for _, t := range tasks {
+		if !t.Finished() {
+			continue
+		}
+		seen[t.ID] = true
+		if reported != nil && !reported[t.ID] {
+			finished = append(finished, t)
+		}
+	}
+	return finished, seen
+}
+
+func (c *Client) triggerSyncDNS(ctx context.Context) error {
+	id, err := directorContainer()
+	if err != nil {
+		return err
+	}
+
+	exec, err := c.dcli.ContainerExecCreate(ctx, id, types.ExecConfig{
+		Cmd:          []string{syncDNSCommand},
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create exec in director container: %s", err)
+	}
+	resp, err := c.dcli.ContainerExecAttach(ctx, exec.ID, types.ExecStartCheck{})
+	if err != nil {
+		return fmt.Errorf("failed to start exec in director container: %s", err)
+	}
+	defer resp.Close()
+	c.logContainerOutput(resp.Reader)
+
+	inspect, err := c.dcli.ContainerExecInspect(ctx, exec.ID)
+	if err != nil {
+		return fmt.Errorf("failed to inspect exec in director container: %s", err)
+	}
+	if inspect.ExitCode != 0 {
+		return fmt.Errorf("%s exited with %d", syncDNSCommand, inspect.ExitCode)
+	}
+	c.logger.Info("Triggered bosh-dns sync")
+	return nil
+}
+
+// directorContainer returns the id of the director container, as recorded
+// by bosh create-env.
+func directorContainer() (string, error) {
+	id, err := deployedDirector()
+	if err != nil {
+		return "", err
+	}
+	if id == "" {
+		return "", fmt.Errorf("director state does not have a VM, has bucc up completed?")
+	}
+	return id, nil
+}
+
+// deployedDirector returns the id of the director container recorded by bosh
+// create-env, or an empty id when no director has been deployed.
+func deployedDirector() (string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(buccHostStateDir, directorStateFile))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read director state: %s", err)
+	}
+	var s struct {
+		CurrentVMCID string `json:"current_vm_cid"`
+	}
+	if err = json.Unmarshal(data, &s); err != nil {
+		return "", fmt.Errorf("failed to unmarshal director state: %s", err)
+	}
+	return s.CurrentVMCID, nil
+}
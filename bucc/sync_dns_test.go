@@ -0,0 +1,48 @@
+package bucc_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/starkandwayne/molten-core/bucc"
+)
+
+var _ = Describe("NewlyFinished", func() {
+	ids := func(tasks []Task) []int {
+		var out []int
+		for _, t := range tasks {
+			out = append(out, t.ID)
+		}
+		return out
+	}
+
+	It("reports tasks finishing after later tasks", func() {
+		finished, reported := NewlyFinished([]Task{
+			{ID: 9, State: "done"},
+		}, nil)
+		Expect(finished).To(BeEmpty())
+
+		finished, reported = NewlyFinished([]Task{
+			{ID: 12, State: "done"},
+			{ID: 11, State: "processing"},
+			{ID: 10, State: "processing"},
+			{ID: 9, State: "done"},
+		}, reported)
+		Expect(ids(finished)).To(Equal([]int{12}))
+
+		finished, reported = NewlyFinished([]Task{
+			{ID: 12, State: "done"},
+			{ID: 11, State: "error"},
+			{ID: 10, State: "done"},
+			{ID: 9, State: "done"},
+		}, reported)
+		Expect(ids(finished)).To(Equal([]int{11, 10}))
+
+		finished, _ = NewlyFinished([]Task{
+			{ID: 12, State: "done"},
+			{ID: 11, State: "error"},
+			{ID: 10, State: "done"},
+		}, reported)
+		Expect(finished).To(BeEmpty())
+	})
+})
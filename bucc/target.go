@@ -0,0 +1,186 @@
+package bucc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/starkandwayne/molten-core/config"
+)
+
+const (
+	directorPort = 25555
+	credhubPort  = 8844
+)
+
+// creds are the client credentials and CA certs from the creds generated by
+// bucc up, which are needed to use BUCC from other nodes.
+type creds struct {
+	AdminPassword            string `json:"admin_password"`
+	CredhubAdminClientSecret string `json:"credhub_admin_client_secret"`
+	DirectorSSL              cert   `json:"director_ssl"`
+	CredhubTLS               cert   `json:"credhub_tls"`
+	UAASSL                   cert   `json:"uaa_ssl"`
+	ATCTLS                   cert   `json:"atc_tls"`
+}
+
+type cert struct {
+	CA string `json:"ca"`
+}
+
+type BOSHTarget struct {
+	Environment  string `json:"environment"`
+	CACert       string `json:"ca_cert"`
+	Client       string `json:"client"`
+	ClientSecret string `json:"client_secret"`
+	AllProxy     string `json:"all_proxy,omitempty"`
+}
+
+type CredHubTarget struct {
+	Server string `json:"server"`
+	CACert string `json:"ca_cert"`
+	Client string `json:"client"`
+	Secret string `json:"secret"`
+	Proxy  string `json:"proxy,omitempty"`
+}
+
+type ConcourseTarget struct {
+	URL      string `json:"url"`
+	Team     string `json:"team"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	CACert   string `json:"ca_cert,omitempty"`
+	// Insecure is only set when the creds do not hold the Concourse CA
+	Insecure bool `json:"insecure"`
+}
+
+type UAATarget struct {
+	URL    string `json:"url"`
+	CACert string `json:"ca_cert"`
+}
+
+// Target bundles the endpoints and credentials needed to use BUCC from a
+// workstation. Concourse and UAA are reached via the public IP of the BUCC
+// node, BOSH and CredHub only listen on the flannel network and need a proxy.
+// With the TLS proxy enabled Concourse, UAA and CredHub are reached via its
+// hostnames instead, which have trusted certificates.
+type Target struct {
+	Name      string          `json:"name"`
+	BOSH      BOSHTarget      `json:"bosh"`
+	CredHub   CredHubTarget   `json:"credhub"`
+	Concourse ConcourseTarget `json:"concourse"`
+	UAA       UAATarget       `json:"uaa"`
+}
+
+// NewTarget builds the target for the BUCC running on node, proxy is an
+// optional BOSH_ALL_PROXY style url (e.g. ssh+socks5://core@host:22?private-key=...).
+func NewTarget(s *config.BUCCState, node config.NodeConfig, cc config.ClusterConfig, proxy string) (*Target, error) {
+	var v Vars
+	if err := yaml.Unmarshal(s.Vars, &v); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal BUCC vars: %s", err)
+	}
+	var c creds
+	if err := yaml.Unmarshal(s.Creds, &c); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal BUCC creds: %s", err)
+	}
+
+	t := &Target{
+		Name: v.Alias,
+		BOSH: BOSHTarget{
+			Environment:  fmt.Sprintf("https://%s:%d", v.InternalIP, directorPort),
+			CACert:       c.DirectorSSL.CA,
+			Client:       "admin",
+			ClientSecret: c.AdminPassword,
+			AllProxy:     proxy,
+		},
+		CredHub: CredHubTarget{
+			Server: fmt.Sprintf("https://%s:%d", v.InternalIP, credhubPort),
+			CACert: strings.Join([]string{c.CredhubTLS.CA, c.UAASSL.CA}, "\n"),
+			Client: "credhub-admin",
+			Secret: c.CredhubAdminClientSecret,
+			Proxy:  proxy,
+		},
+		Concourse: ConcourseTarget{
+			URL:      fmt.Sprintf("https://%s:%s", node.PublicIP, v.ConcourseHostPort),
+			Team:     "main",
+			Username: "admin",
+			Password: c.AdminPassword,
+			CACert:   c.ATCTLS.CA,
+			Insecure: c.ATCTLS.CA == "",
+		},
+		UAA: UAATarget{
+			URL:    fmt.Sprintf("https://%s:%s", node.PublicIP, v.UAAHostPort),
+			CACert: c.UAASSL.CA,
+		},
+	}
+	if cc.Proxy.Enabled() {
+		t.CredHub.Server = fmt.Sprintf("https://credhub.%s", cc.Proxy.Domain)
+		t.CredHub.CACert = ""
+		t.Concourse.URL = fmt.Sprintf("https://concourse.%s", cc.Proxy.Domain)
+		t.Concourse.CACert, t.Concourse.Insecure = "", false
+		t.UAA.URL = fmt.Sprintf("https://uaa.%s", cc.Proxy.Domain)
+		t.UAA.CACert = ""
+	}
+	return t, nil
+}
+
+// Env renders the target as shell exports for the bosh and credhub cli.
+func (t Target) Env() string {
+	var b bytes.Buffer
+	export := func(k, v string) {
+		if v != "" {
+			fmt.Fprintf(&b, "export %s=%s\n", k, shellQuote(v))
+		}
+	}
+	export("BOSH_ENVIRONMENT", t.BOSH.Environment)
+	export("BOSH_CA_CERT", t.BOSH.CACert)
+	export("BOSH_CLIENT", t.BOSH.Client)
+	export("BOSH_CLIENT_SECRET", t.BOSH.ClientSecret)
+	export("BOSH_ALL_PROXY", t.BOSH.AllProxy)
+	export("CREDHUB_SERVER", t.CredHub.Server)
+	export("CREDHUB_CA_CERT", t.CredHub.CACert)
+	export("CREDHUB_CLIENT", t.CredHub.Client)
+	export("CREDHUB_SECRET", t.CredHub.Secret)
+	export("CREDHUB_PROXY", t.CredHub.Proxy)
+	return b.String()
+}
+
+// Fly renders the fly login command for the Concourse target.
+func (t Target) Fly() string {
+	args := []string{"fly", "-t", t.Name, "login",
+		"-c", t.Concourse.URL,
+		"-n", t.Concourse.Team,
+		"-u", t.Concourse.Username,
+		"-p", shellQuote(t.Concourse.Password)}
+	if t.Concourse.CACert != "" {
+		// passed on stdin, the login command is also piped to plain sh
+		args = append([]string{"echo", shellQuote(t.Concourse.CACert), "|"}, append(args, "--ca-cert", "/dev/stdin")...)
+	} else if t.Concourse.Insecure {
+		args = append(args, "-k")
+	}
+	return strings.Join(args, " ") + "\n"
+}
+
+func (t Target) JSON() (string, error) {
+	raw, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal target: %s", err)
+	}
+	return string(raw) + "\n", nil
+}
+
+// YAML renders a kubeconfig style document, with the target as its
+// current (and only) context.
+func (t Target) YAML() (string, error) {
+	raw, err := yaml.Marshal(struct {
+		CurrentTarget string   `json:"current-target"`
+		Targets       []Target `json:"targets"`
+	}{t.Name, []Target{t}})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal target: %s", err)
+	}
+	return string(raw), nil
+}
@@ -0,0 +1,118 @@
+package bucc_test
+
+import (
+	"net"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/starkandwayne/molten-core/bucc"
+	"github.com/starkandwayne/molten-core/config"
+)
+
+var _ = Describe("Target", func() {
+	var target *Target
+
+	BeforeEach(func() {
+		state := config.BUCCState{
+			Host: net.ParseIP("192.168.1.10"),
+			Vars: []byte(`{"alias":"mc","internal_ip":"10.1.1.10","concourse_host_port":"1443","uaa_host_port":"1444"}`),
+			Creds: []byte(`
+admin_password: secret
+credhub_admin_client_secret: it's-secret
+director_ssl:
+  ca: director-ca
+credhub_tls:
+  ca: credhub-ca
+uaa_ssl:
+  ca: uaa-ca
+atc_tls:
+  ca: concourse-ca
+`),
+		}
+
+		var err error
+		target, err = NewTarget(&state, node(0), config.DefaultClusterConfig(), "")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("renders shell exports", func() {
+		Expect(target.Env()).To(Equal(`export BOSH_ENVIRONMENT='https://10.1.1.10:25555'
+export BOSH_CA_CERT='director-ca'
+export BOSH_CLIENT='admin'
+export BOSH_CLIENT_SECRET='secret'
+export CREDHUB_SERVER='https://10.1.1.10:8844'
+export CREDHUB_CA_CERT='credhub-ca
+uaa-ca'
+export CREDHUB_CLIENT='credhub-admin'
+export CREDHUB_SECRET='it'\''s-secret'
+`))
+	})
+
+	It("renders a fly login using the public ip", func() {
+		Expect(target.Fly()).To(Equal("echo 'concourse-ca' | fly -t mc login -c https://192.168.2.10:1443 -n main -u admin -p 'secret' --ca-cert /dev/stdin\n"))
+	})
+
+	It("skips verifying Concourse without its CA", func() {
+		t, err := NewTarget(&config.BUCCState{
+			Vars:  []byte(`{"alias":"mc","concourse_host_port":"1443"}`),
+			Creds: []byte("admin_password: secret\n"),
+		}, node(0), config.DefaultClusterConfig(), "")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(t.Fly()).To(Equal("fly -t mc login -c https://192.168.2.10:1443 -n main -u admin -p 'secret' -k\n"))
+	})
+
+	It("uses the TLS proxy hostnames with their trusted certificates", func() {
+		cc := config.DefaultClusterConfig()
+		cc.Proxy.Domain = "mc.example.com"
+		t, err := NewTarget(&config.BUCCState{
+			Vars:  []byte(`{"alias":"mc","internal_ip":"10.1.1.10","concourse_host_port":"1443","uaa_host_port":"1444"}`),
+			Creds: []byte("admin_password: secret\natc_tls:\n  ca: concourse-ca\n"),
+		}, node(0), cc, "")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(t.CredHub.Server).To(Equal("https://credhub.mc.example.com"))
+		Expect(t.CredHub.CACert).To(BeEmpty())
+		Expect(t.UAA.URL).To(Equal("https://uaa.mc.example.com"))
+		Expect(t.BOSH.Environment).To(Equal("https://10.1.1.10:25555"))
+		Expect(t.Fly()).To(Equal("fly -t mc login -c https://concourse.mc.example.com -n main -u admin -p 'secret'\n"))
+	})
+
+	It("renders json", func() {
+		out, err := target.JSON()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(out).To(MatchJSON(`{
+  "name": "mc",
+  "bosh": {
+    "environment": "https://10.1.1.10:25555",
+    "ca_cert": "director-ca",
+    "client": "admin",
+    "client_secret": "secret"
+  },
+  "credhub": {
+    "server": "https://10.1.1.10:8844",
+    "ca_cert": "credhub-ca\nuaa-ca",
+    "client": "credhub-admin",
+    "secret": "it's-secret"
+  },
+  "concourse": {
+    "url": "https://192.168.2.10:1443",
+    "team": "main",
+    "username": "admin",
+    "password": "secret",
+    "ca_cert": "concourse-ca",
+    "insecure": false
+  },
+  "uaa": {
+    "url": "https://192.168.2.10:1444",
+    "ca_cert": "uaa-ca"
+  }
+}`))
+	})
+
+	It("renders a kubeconfig style yaml", func() {
+		out, err := target.YAML()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(out).To(ContainSubstring("current-target: mc\n"))
+		Expect(out).To(ContainSubstring("environment: https://10.1.1.10:25555\n"))
+	})
+})
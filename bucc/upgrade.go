@@ -0,0 +1,126 @@
+package bucc
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/starkandwayne/molten-core/util"
+)
+
+const (
+	buccBackupDirTmpl   = "/var/lib/moltencore/bucc-backup-%s"
+	healthCheckAttempts = 10
+	healthCheckInterval = 15 * time.Second
+	rollbackTimeout     = 30 * time.Minute
+)
+
+// Upgrade redeploys BUCC with the given image (or the image pinned by this mc
+// release). The state dir is backed up first, and restored together with the
+// previously deployed image when the director does not come back healthy.
+// rollbackImage is only used when the deployed image has not been recorded,
+// e.g. for BUCC deployed by older mc releases.
+func (c *Client) Upgrade(ctx context.Context, image, rollbackImage string) error {
+	if image != "" && c.offline() {
+		return fmt.Errorf("offline clusters are upgraded to the image in the offline image archive, update it with mc init instead")
+	}
+
+	release, err := lockFile(buccLockFile)
+	if err != nil {
+		return fmt.Errorf("failed to lock %s: %s", buccLockFile, err)
+	}
+	defer release()
+
+	previous, err := deployedImage()
+	if err != nil {
+		return fmt.Errorf("failed to read deployed image: %s", err)
+	}
+	if previous == "" && rollbackImage == "" {
+		return fmt.Errorf("the deployed BUCC image is not recorded in %s, give the image BUCC is running now to roll back to",
+			filepath.Join(buccHostStateDir, deployedImageFile))
+	}
+	if previous == "" {
+		previous = c.cluster.Image(rollbackImage)
+	}
+	if image != "" {
+		c.image = c.cluster.Image(image)
+	}
+
+	if err = c.fetchImage(ctx); err != nil {
+		return err
+	}
+
+	backup := fmt.Sprintf(buccBackupDirTmpl, time.Now().UTC().Format("20060102T150405Z"))
+	c.logger.Infof("Backing up BUCC state to %s", backup)
+	if err = util.CopyDir(buccHostStateDir, backup); err != nil {
+		return fmt.Errorf("failed to back up state dir: %s", err)
+	}
+	if err = pruneBackups(backup); err != nil {
+		c.logger.Warnf("Failed to remove old BUCC state backups: %s", err)
+	}
+
+	c.logger.Infof("Upgrading BUCC from %s to %s", previous, c.image)
+	err = c.up(ctx)
+	if err == nil {
+		err = c.waitHealthy(ctx)
+	}
+	if err == nil {
+		return nil
+	}
+
+	c.logger.Warnf("BUCC upgrade failed, rolling back to %s: %s", previous, err)
+	if rerr := restoreStateDir(backup); rerr != nil {
+		return fmt.Errorf("failed to restore state dir from %s: %s (upgrade failed with: %s)", backup, rerr, err)
+	}
+	c.image = previous
+	// ctx may have been cancelled, which is why the upgrade failed
+	rctx, cancel := context.WithTimeout(context.Background(), rollbackTimeout)
+	defer cancel()
+	if rerr := c.up(rctx); rerr != nil {
+		return fmt.Errorf("failed to roll back to %s: %s (upgrade failed with: %s)", previous, rerr, err)
+	}
+	return fmt.Errorf("upgrade failed and was rolled back to %s: %s", previous, err)
+}
+
+func (c *Client) waitHealthy(ctx context.Context) error {
+	var err error
+	for i := 0; i < healthCheckAttempts; i++ {
+		c.logger.Info("Waiting for BOSH director to become healthy")
+		err = c.run(ctx, []string{"/bin/bash", "-c", "source <(/bucc/bin/bucc env) && bosh env"}, false)
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("BOSH director is not healthy: %s", ctx.Err())
+		case <-time.After(healthCheckInterval):
+		}
+	}
+	return fmt.Errorf("BOSH director is not healthy: %s", err)
+}
+
+func restoreStateDir(backup string) error {
+	if err := os.RemoveAll(buccHostStateDir); err != nil {
+		return err
+	}
+	return util.CopyDir(backup, buccHostStateDir)
+}
+
+// pruneBackups removes the state dir backups other than keep.
+func pruneBackups(keep string) error {
+	backups, err := filepath.Glob(fmt.Sprintf(buccBackupDirTmpl, "*"))
+	if err != nil {
+		return err
+	}
+	for _, b := range backups {
+		if b == keep {
+			continue
+		}
+		if err = os.RemoveAll(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -91,3 +91,16 @@ func Genereate(a GenArg) (Cert, error) {
 	}, nil
 
 }
+
+// NotAfter returns the time the certificate expires.
+func (c Cert) NotAfter() (time.Time, error) {
+	block, _ := pem.Decode(c.Cert)
+	if block == nil {
+		return time.Time{}, fmt.Errorf("failed to decode certificate")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse certificate: %s", err)
+	}
+	return cert.NotAfter, nil
+}
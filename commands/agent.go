@@ -0,0 +1,270 @@
+package commands
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/starkandwayne/molten-core/bucc"
+	"github.com/starkandwayne/molten-core/config"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+const (
+	agentStatusFile = "/run/moltencore/agent.json"
+)
+
+// AgentCommand converges the node like init, and keeps repeating that to
+// repair drift. On node z0 it also deploys BUCC and updates its configs.
+type AgentCommand struct {
+	logger       *logrus.Entry
+	init         InitCommand
+	interval     time.Duration
+	drainTimeout time.Duration
+	listen       string
+
+	mu             sync.Mutex
+	status         agentStatus
+	conf           *config.NodeConfig
+	configsUpdated time.Time
+	buccDeploys    int
+
+	configured  bool
+	configsHash string
+	stateSaved  bool
+}
+
+// agentStatus is the result of the last reconcile pass of mc agent.
+type agentStatus struct {
+	Zone     string       `json:"zone"`
+	Started  time.Time    `json:"started"`
+	Finished time.Time    `json:"finished"`
+	Healthy  bool         `json:"healthy"`
+	Steps    []stepStatus `json:"steps"`
+}
+
+type stepStatus struct {
+	Name     string `json:"name"`
+	Duration string `json:"duration"`
+	Error    string `json:"error,omitempty"`
+}
+
+func (cmd *AgentCommand) register(app *kingpin.Application) {
+	c := app.Command("agent", "bootstrap the node and keep converging it").Action(cmd.run)
+	cmd.init.registerFlags(c)
+	// the timeout applies to each reconcile pass
+	cmd.init.deadline.register(c, "2h")
+	c.Flag("interval", "Time between reconcile passes").Default("5m").DurationVar(&cmd.interval)
+	c.Flag("drain-timeout", "Time containers get to stop before a changed bosh network is recreated").Default("30s").DurationVar(&cmd.drainTimeout)
+	c.Flag("listen", "Address to serve the status of the last reconcile pass and metrics on (e.g. 127.0.0.1:8092)").StringVar(&cmd.listen)
+}
+
+func (cmd *AgentCommand) run(c *kingpin.ParseContext) error {
+	cmd.init.logger = cmd.logger
+	cmd.init.agent = true
+
+	// run until interrupted
+	ctx, cancel := deadline{}.context(cmd.logger)
+	defer cancel()
+
+	if cmd.listen != "" {
+		srv := &http.Server{Addr: cmd.listen, Handler: cmd.handler()}
+		go func() {
+			<-ctx.Done()
+			srv.Shutdown(context.Background())
+		}()
+		go func() {
+			cmd.logger.Infof("Serving agent status and metrics on %s", cmd.listen)
+			if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+				cmd.logger.Errorf("Failed to serve agent status: %s", err)
+			}
+		}()
+	}
+
+	for {
+		cmd.reconcile(ctx)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(cmd.interval):
+		}
+	}
+}
+
+// reconcile runs all steps once, steps which fail are retried in the next
+// pass, the steps after them still run.
+func (cmd *AgentCommand) reconcile(ctx context.Context) {
+	status := agentStatus{Started: time.Now(), Healthy: true}
+	record := func(name string, start time.Time, err error) {
+		s := stepStatus{Name: name, Duration: time.Since(start).Round(time.Millisecond).String()}
+		if err != nil {
+			cmd.logger.WithField("phase", name).Error(err)
+			s.Error = err.Error()
+			status.Healthy = false
+		}
+		status.Steps = append(status.Steps, s)
+	}
+
+	if cmd.init.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cmd.init.timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	conf, cc, err := cmd.init.configure(ctx, !cmd.configured)
+	record("config", start, err)
+	if err == nil {
+		cmd.configured = true
+		status.Zone = conf.Zone()
+		for _, s := range cmd.steps(conf, cc) {
+			start = time.Now()
+			record(s.name, start, s.run(ctx))
+		}
+	}
+
+	status.Finished = time.Now()
+	cmd.mu.Lock()
+	cmd.status = status
+	if conf != nil {
+		cmd.conf = conf
+	}
+	cmd.mu.Unlock()
+	if err = writeAgentStatus(status); err != nil {
+		cmd.logger.Errorf("Failed to write agent status: %s", err)
+	}
+}
+
+func (cmd *AgentCommand) steps(conf *config.NodeConfig, cc *config.ClusterConfig) []step {
+	steps := append(cmd.init.steps(conf, cc), step{"network", func(ctx context.Context) error {
+		return reconcileNetwork(ctx, cmd.init.logger, conf, cmd.drainTimeout)
+	}})
+	if !conf.IsSingletonZone() {
+		return steps
+	}
+	return append(steps,
+		step{"bucc", func(ctx context.Context) error {
+			return cmd.deployBUCC(ctx, conf, cc)
+		}},
+		step{"bosh-configs", func(ctx context.Context) error {
+			return cmd.updateConfigs(ctx, conf, cc)
+		}},
+	)
+}
+
+// deployBUCC runs bucc up when the director is not running, e.g. after a
+// reboot of the node.
+func (cmd *AgentCommand) deployBUCC(ctx context.Context, conf *config.NodeConfig, cc *config.ClusterConfig) error {
+	logger := cmd.init.logger.WithField("phase", "bucc")
+	bc, err := bucc.NewClient(ctx, logger, conf, cc)
+	if err != nil {
+		return fmt.Errorf("failed create BUCC client: %s", err)
+	}
+	defer bc.Close()
+	deployed, err := bc.EnsureUp(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create BUCC container: %s", err)
+	}
+	if !deployed {
+		// replaces the state stored in etcd by older mc releases
+		if !cmd.stateSaved {
+			if err = bc.SaveState(ctx); err != nil {
+				return fmt.Errorf("failed to store BUCC state: %s", err)
+			}
+			cmd.stateSaved = true
+		}
+		return nil
+	}
+	// configs of a recreated director have to be updated as well
+	cmd.configsHash = ""
+	cmd.mu.Lock()
+	cmd.buccDeploys++
+	cmd.mu.Unlock()
+	return nil
+}
+
+// updateConfigs updates the BOSH configs when the node or cluster configs
+// have changed since the last successful update.
+func (cmd *AgentCommand) updateConfigs(ctx context.Context, conf *config.NodeConfig, cc *config.ClusterConfig) error {
+	confs, err := config.LoadNodeConfigs(ctx)
+	if err != nil {
+		return fmt.Errorf("failed load node configs: %s", err)
+	}
+
+	raw, err := json.Marshal(struct {
+		Nodes   *[]config.NodeConfig
+		Cluster *config.ClusterConfig
+	}{confs, cc})
+	if err != nil {
+		return fmt.Errorf("failed to marshal configs: %s", err)
+	}
+	hash := fmt.Sprintf("%x", sha256.Sum256(raw))
+	if hash == cmd.configsHash {
+		return nil
+	}
+
+	if err = updateBUCCConfigs(ctx, cmd.init.logger, conf, confs, cc); err != nil {
+		return err
+	}
+	cmd.configsHash = hash
+	cmd.mu.Lock()
+	cmd.configsUpdated = time.Now()
+	cmd.mu.Unlock()
+	return nil
+}
+
+func (cmd *AgentCommand) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		cmd.mu.Lock()
+		status := cmd.status
+		cmd.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		if !status.Healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(status)
+	})
+	mux.HandleFunc("/metrics", cmd.serveMetrics)
+	return mux
+}
+
+func writeAgentStatus(s agentStatus) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(agentStatusFile), 0755); err != nil {
+		return err
+	}
+	tmp := agentStatusFile + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, agentStatusFile)
+}
+
+func loadAgentStatus() (*agentStatus, error) {
+	data, err := ioutil.ReadFile(agentStatusFile)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no agent status found in %s, is mc agent running?", agentStatusFile)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read agent status: %s", err)
+	}
+	var s agentStatus
+	if err = json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal agent status: %s", err)
+	}
+	return &s, nil
+}
@@ -0,0 +1,55 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+	"github.com/starkandwayne/molten-core/blobstore"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+const (
+	defaultBlobstoreDir = "/var/lib/moltencore/blobstore"
+)
+
+type BlobstoreCommand struct {
+	logger *logrus.Entry
+	dir    string
+	listen string
+}
+
+func (cmd *BlobstoreCommand) register(app *kingpin.Application) {
+	c := app.Command("blobstore", "serve releases and stemcells for offline clusters").Action(cmd.run)
+	c.Flag("dir", "Directory containing the blobs and a SHA256SUMS manifest").Default(defaultBlobstoreDir).ExistingDirVar(&cmd.dir)
+	c.Flag("listen", "Address to listen on").Required().StringVar(&cmd.listen)
+}
+
+func (cmd *BlobstoreCommand) run(c *kingpin.ParseContext) error {
+	cmd.logger.Infof("Verifying blobs in %s", cmd.dir)
+	m, err := blobstore.LoadManifest(cmd.dir)
+	if err != nil {
+		return err
+	}
+	if err = m.Verify(cmd.dir); err != nil {
+		return fmt.Errorf("failed to verify blobstore: %s", err)
+	}
+
+	// serve until interrupted
+	ctx, cancel := deadline{}.context(cmd.logger)
+	defer cancel()
+
+	srv := &http.Server{Addr: cmd.listen, Handler: m.Handler(cmd.dir)}
+	go func() {
+		<-ctx.Done()
+		cmd.logger.Info("Shutting down blobstore")
+		srv.Shutdown(context.Background())
+	}()
+
+	cmd.logger.Infof("Serving %d blobs on %s", len(m), cmd.listen)
+	if err = srv.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
@@ -2,40 +2,46 @@ package commands
 
 import (
 	"fmt"
-	"log"
 
+	"github.com/sirupsen/logrus"
 	"github.com/starkandwayne/molten-core/bucc"
 	"github.com/starkandwayne/molten-core/config"
 	kingpin "gopkg.in/alecthomas/kingpin.v2"
 )
 
 type BUCCUpCommand struct {
-	logger *log.Logger
+	logger *logrus.Entry
+	deadline
 }
 
 func (cmd *BUCCUpCommand) register(app *kingpin.Application) {
-	app.Command("bucc-up", "create or update BUCC").Action(cmd.run)
+	c := app.Command("bucc-up", "create or update BUCC").Action(cmd.run)
+	cmd.deadline.register(c, "1h")
 }
 
 func (cmd *BUCCUpCommand) run(c *kingpin.ParseContext) error {
-	cmd.logger.Printf("Loading node config")
-	conf, err := config.LoadNodeConfig()
+	ctx, cancel := cmd.context(cmd.logger)
+	defer cancel()
+
+	cmd.logger.Info("Loading node config")
+	conf, err := config.LoadNodeConfig(ctx)
 	if err != nil {
 		return fmt.Errorf("failed load node config: %s", err)
 	}
 
-	bc, err := bucc.NewClient(cmd.logger, conf)
+	cc, err := config.LoadClusterConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("failed load cluster config: %s", err)
+	}
+
+	bc, err := bucc.NewClient(ctx, cmd.logger, conf, cc)
 	if err != nil {
 		return fmt.Errorf("failed create BUCC client: %s", err)
 	}
+	defer bc.Close()
 
-	if err = bc.Up(); err != nil {
+	if err = bc.Up(ctx); err != nil {
 		return fmt.Errorf("failed to create BUCC container: %s", err)
 	}
-
-	// TODO store creds and state in etcd currently just in file
-	// load bucc creds from etcds
-	// bucc int to generate creds
-	// save creds and vars to etcd
 	return nil
 }
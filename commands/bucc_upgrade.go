@@ -0,0 +1,69 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"github.com/starkandwayne/molten-core/bucc"
+	"github.com/starkandwayne/molten-core/config"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+type BUCCUpgradeCommand struct {
+	logger        *logrus.Entry
+	image         string
+	rollbackImage string
+	deadline
+}
+
+func (cmd *BUCCUpgradeCommand) register(app *kingpin.Application) {
+	c := app.Command("bucc-upgrade", "upgrade BUCC to a new image, rolling back on failure").Action(cmd.run)
+	c.Flag("image", "BUCC image to upgrade to, defaults to the image pinned by this mc release").StringVar(&cmd.image)
+	c.Flag("rollback-image", "BUCC image to roll back to, only needed when the deployed image has not been recorded by an older mc release").StringVar(&cmd.rollbackImage)
+	cmd.deadline.register(c, "2h")
+}
+
+func (cmd *BUCCUpgradeCommand) run(c *kingpin.ParseContext) error {
+	ctx, cancel := cmd.context(cmd.logger)
+	defer cancel()
+
+	cmd.logger.Info("Loading node config")
+	conf, err := config.LoadNodeConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("failed load node config: %s", err)
+	}
+	if !conf.IsSingletonZone() {
+		return fmt.Errorf("BUCC is only running on zone z0, this node is %s", conf.Zone())
+	}
+
+	cc, err := config.LoadClusterConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("failed load cluster config: %s", err)
+	}
+
+	bc, err := bucc.NewClient(ctx, cmd.logger, conf, cc)
+	if err != nil {
+		return fmt.Errorf("failed create BUCC client: %s", err)
+	}
+	defer bc.Close()
+
+	if err = bc.Upgrade(ctx, cmd.image, cmd.rollbackImage); err != nil {
+		return fmt.Errorf("failed to upgrade BUCC: %s", err)
+	}
+
+	if cmd.image == "" {
+		return nil
+	}
+	_, err = config.UpdateClusterConfig(ctx, func(cc *config.ClusterConfig) (bool, error) {
+		if cc.BUCCImage == cmd.image {
+			return false, nil
+		}
+		cmd.logger.Info("Updating cluster config")
+		cc.BUCCImage = cmd.image
+		return true, nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update cluster config: %s", err)
+	}
+	return nil
+}
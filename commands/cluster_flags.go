@@ -0,0 +1,175 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/starkandwayne/molten-core/bucc"
+	"github.com/starkandwayne/molten-core/config"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+// clusterFlags are the cluster wide settings which can be passed to mc init,
+// only flags given on the command line overwrite the settings stored in etcd.
+type clusterFlags struct {
+	dnsRecursors        []string
+	boshDNS             config.Release
+	addonFiles          []string
+	registry            string
+	buccImage           string
+	bucc                config.BUCC
+	proxy               config.Proxy
+	offline             bool
+	offlineSet          bool
+	offlineImageArchive string
+	offlineImageSHA256  string
+	offlineBlobstoreURL string
+	docker              config.DockerDaemon
+	dockerIPMasqSet     bool
+}
+
+func (f *clusterFlags) register(c *kingpin.CmdClause) {
+	c.Flag("dns-recursor", "DNS recursor used by bosh-dns, defaults to the host resolv.conf (repeatable)").StringsVar(&f.dnsRecursors)
+	c.Flag("bosh-dns-version", "Version of the bosh-dns release").StringVar(&f.boshDNS.Version)
+	c.Flag("bosh-dns-url", "URL of the bosh-dns release").StringVar(&f.boshDNS.URL)
+	c.Flag("bosh-dns-sha1", "SHA1 of the bosh-dns release").StringVar(&f.boshDNS.SHA1)
+	c.Flag("runtime-addon", "Runtime config fragment with addons to add to the BOSH runtime config (repeatable)").ExistingFilesVar(&f.addonFiles)
+	c.Flag("registry", "Registry mirror used for pulling images").StringVar(&f.registry)
+	c.Flag("bucc-image", "BUCC image override, defaults to the image pinned by this mc release").StringVar(&f.buccImage)
+	c.Flag("director-name", "Name of the BOSH director").StringVar(&f.bucc.DirectorName)
+	c.Flag("alias", "Alias used for the BOSH environment and the fly target").StringVar(&f.bucc.Alias)
+	c.Flag("concourse-port", "Host port Concourse is published on").IntVar(&f.bucc.ConcoursePort)
+	c.Flag("uaa-port", "Host port UAA is published on").IntVar(&f.bucc.UAAPort)
+	c.Flag("bucc-ip-index", "Host index of the BOSH director IP in the subnet of node z0").IntVar(&f.bucc.IPHostIndex)
+	c.Flag("proxy-domain", "Domain to expose Concourse, UAA and CredHub on as subdomains, enables the TLS proxy").StringVar(&f.proxy.Domain)
+	c.Flag("proxy-image", "Image of the TLS proxy").StringVar(&f.proxy.Image)
+	c.Flag("proxy-acme-email", "Email address used for the ACME account of the TLS proxy").StringVar(&f.proxy.ACMEEmail)
+	c.Flag("proxy-acme-ca", "ACME directory url, defaults to Let's Encrypt").StringVar(&f.proxy.ACMECA)
+	c.Flag("docker-bridge-ip", "Address and network of the default docker bridge (--bip)").StringVar(&f.docker.BridgeIP)
+	c.Flag("docker-mtu", "MTU of the default docker bridge").IntVar(&f.docker.MTU)
+	c.Flag("docker-ip-masq", "Masquerade traffic leaving the default docker bridge").
+		Action(func(*kingpin.ParseContext) error { f.dockerIPMasqSet = true; return nil }).BoolVar(&f.docker.IPMasq)
+	c.Flag("docker-storage-driver", "Storage driver of the docker daemon, defaults to the docker default").StringVar(&f.docker.StorageDriver)
+	c.Flag("docker-data-root", "Data root of the docker daemon, defaults to /var/lib/docker").StringVar(&f.docker.DataRoot)
+	c.Flag("docker-log-driver", "Log driver for containers").StringVar(&f.docker.LogDriver)
+	c.Flag("docker-log-max-size", "Size at which container logs are rotated (json-file and local log drivers)").StringVar(&f.docker.LogMaxSize)
+	c.Flag("docker-log-max-file", "Number of rotated container logs kept").IntVar(&f.docker.LogMaxFile)
+	c.Flag("offline", "Run without internet access, images and releases are loaded from local sources").
+		Action(func(*kingpin.ParseContext) error { f.offlineSet = true; return nil }).BoolVar(&f.offline)
+	c.Flag("offline-image-archive", "Path to a docker save archive of the BUCC image").StringVar(&f.offlineImageArchive)
+	c.Flag("offline-image-sha256", "Pinned sha256 digest of the BUCC image archive").StringVar(&f.offlineImageSHA256)
+	c.Flag("offline-blobstore-url", "Blobstore serving releases and stemcells, defaults to the blobstore on the BUCC node").StringVar(&f.offlineBlobstoreURL)
+}
+
+// apply updates cc with the flags given on the command line,
+// and reports whether anything has changed.
+func (f *clusterFlags) apply(cc *config.ClusterConfig) (bool, error) {
+	before, err := json.Marshal(cc)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal cluster config: %s", err)
+	}
+
+	if len(f.dnsRecursors) != 0 {
+		cc.Runtime.DNSRecursors = f.dnsRecursors
+	}
+	if f.boshDNS.Version != "" {
+		cc.Runtime.BOSHDNS.Version = f.boshDNS.Version
+	}
+	if f.boshDNS.URL != "" {
+		cc.Runtime.BOSHDNS.URL = f.boshDNS.URL
+	}
+	if f.boshDNS.SHA1 != "" {
+		cc.Runtime.BOSHDNS.SHA1 = f.boshDNS.SHA1
+	}
+
+	if len(f.addonFiles) != 0 {
+		rc := config.RuntimeConfig{}
+		for _, path := range f.addonFiles {
+			raw, err := ioutil.ReadFile(path)
+			if err != nil {
+				return false, fmt.Errorf("failed to read runtime addon %s: %s", path, err)
+			}
+			if err = rc.AddAddons(raw); err != nil {
+				return false, fmt.Errorf("failed to load runtime addon %s: %s", path, err)
+			}
+		}
+		cc.Runtime.Addons = rc.Addons
+		cc.Runtime.Releases = rc.Releases
+		cc.Runtime.Variables = rc.Variables
+	}
+
+	if f.registry != "" {
+		cc.Registry = f.registry
+	}
+	if f.buccImage != "" {
+		cc.BUCCImage = f.buccImage
+	}
+	if f.bucc.DirectorName != "" {
+		cc.BUCC.DirectorName = f.bucc.DirectorName
+	}
+	if f.bucc.Alias != "" {
+		cc.BUCC.Alias = f.bucc.Alias
+	}
+	if f.bucc.ConcoursePort != 0 {
+		cc.BUCC.ConcoursePort = f.bucc.ConcoursePort
+	}
+	if f.bucc.UAAPort != 0 {
+		cc.BUCC.UAAPort = f.bucc.UAAPort
+	}
+	if f.bucc.IPHostIndex != 0 {
+		cc.BUCC.IPHostIndex = f.bucc.IPHostIndex
+	}
+	if f.proxy.Domain != "" {
+		cc.Proxy.Domain = f.proxy.Domain
+	}
+	if f.proxy.Image != "" {
+		cc.Proxy.Image = f.proxy.Image
+	}
+	if f.proxy.ACMEEmail != "" {
+		cc.Proxy.ACMEEmail = f.proxy.ACMEEmail
+	}
+	if f.proxy.ACMECA != "" {
+		cc.Proxy.ACMECA = f.proxy.ACMECA
+	}
+	if f.offlineSet {
+		cc.Offline.Enabled = f.offline
+	}
+	if f.offlineImageArchive != "" {
+		cc.Offline.ImageArchive = f.offlineImageArchive
+	}
+	if f.offlineImageSHA256 != "" {
+		cc.Offline.ImageArchiveSHA256 = f.offlineImageSHA256
+	}
+	if f.offlineBlobstoreURL != "" {
+		cc.Offline.BlobstoreURL = f.offlineBlobstoreURL
+	}
+
+	cc.DockerDaemon = cc.DockerDaemon.Override(f.docker)
+	if f.dockerIPMasqSet {
+		cc.DockerDaemon.IPMasq = f.docker.IPMasq
+	}
+
+	if cc.Offline.Enabled && cc.Registry == "" &&
+		(cc.Offline.ImageArchive == "" || cc.Offline.ImageArchiveSHA256 == "") {
+		return false, fmt.Errorf("offline mode requires a registry mirror or an image archive with its sha256")
+	}
+
+	if cc.BUCC.ConcoursePort == cc.BUCC.UAAPort {
+		return false, fmt.Errorf("concourse and uaa can not be published on the same port: %d", cc.BUCC.UAAPort)
+	}
+
+	if err = bucc.ValidateIPHostIndex(cc.BUCC.IPHostIndex); err != nil {
+		return false, err
+	}
+
+	if err = cc.DockerDaemon.Validate(); err != nil {
+		return false, err
+	}
+
+	after, err := json.Marshal(cc)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal cluster config: %s", err)
+	}
+	return string(before) != string(after), nil
+}
@@ -1,8 +1,7 @@
 package commands
 
 import (
-	"log"
-
+	"github.com/sirupsen/logrus"
 	kingpin "gopkg.in/alecthomas/kingpin.v2"
 )
 
@@ -11,12 +10,33 @@ type register interface {
 }
 
 // Configure sets up the kingpin commands for the mc-cli.
-func Configure(logger *log.Logger, app *kingpin.Application) {
+func Configure(logger *logrus.Logger, app *kingpin.Application) {
+	// pass flags after the first argument on to commands run by exec
+	app.Interspersed(false)
+
+	configureLogging(logger, app)
+	l := func(command string) *logrus.Entry {
+		return logger.WithField("command", command)
+	}
+
 	cmds := []register{
-		&InitCommand{logger: logger},
-		&BUCCUpCommand{logger: logger},
-		&UpdateBUCCConfigsCommand{logger: logger},
-		&ShellCommand{logger: logger},
+		&InitCommand{logger: l("init")},
+		&BUCCUpCommand{logger: l("bucc-up")},
+		&BUCCUpgradeCommand{logger: l("bucc-upgrade")},
+		&UpdateBUCCConfigsCommand{logger: l("update-bucc-configs")},
+		&ShellCommand{logger: l("shell")},
+		&ExecCommand{logger: l("exec"), name: "exec", help: "run a command with the BUCC environment"},
+		&ExecCommand{logger: l("bosh"), name: "bosh", help: "run the bosh cli against BUCC", prefix: []string{"bosh"}},
+		&ExecCommand{logger: l("credhub"), name: "credhub", help: "run the credhub cli against BUCC", prefix: []string{"credhub"}},
+		&ExecCommand{logger: l("fly"), name: "fly", help: "run the fly cli against BUCC", fly: true},
+		&TargetCommand{logger: l("target")},
+		&BlobstoreCommand{logger: l("blobstore")},
+		&UnitsRenderCommand{logger: l("units")},
+		&UninstallCommand{logger: l("uninstall")},
+		&SyncDNSCommand{logger: l("sync-dns")},
+		&ReconcileNetworkCommand{logger: l("reconcile-network")},
+		&AgentCommand{logger: l("agent")},
+		&StatusCommand{logger: l("status")},
 	}
 
 	for _, c := range cmds {
@@ -0,0 +1,54 @@
+package commands
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/starkandwayne/molten-core/util"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+// deadline holds the --timeout flag of a command.
+type deadline struct {
+	timeout time.Duration
+}
+
+func (d *deadline) register(c *kingpin.CmdClause, timeout string) {
+	c.Flag("timeout", "Give up after this duration, 0 waits forever").Default(timeout).DurationVar(&d.timeout)
+}
+
+// context returns the root context of a command, which is canceled on SIGINT
+// and SIGTERM or when the timeout expires. Call the returned func when done.
+// The context carries l for logging retries.
+func (d deadline) context(l *logrus.Entry) (context.Context, context.CancelFunc) {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+	if d.timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), d.timeout)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+
+	ctx = util.WithLogger(ctx, l)
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-sigs:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, func() {
+		signal.Stop(sigs)
+		cancel()
+	}
+}
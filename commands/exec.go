@@ -0,0 +1,91 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"github.com/starkandwayne/molten-core/bucc"
+	"github.com/starkandwayne/molten-core/config"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+type ExecCommand struct {
+	logger *logrus.Entry
+	name   string
+	help   string
+	prefix []string
+	fly    bool
+	args   []string
+	deadline
+}
+
+func (cmd *ExecCommand) register(app *kingpin.Application) {
+	c := app.Command(cmd.name, cmd.help).Action(cmd.run)
+	cmd.deadline.register(c, "0s")
+	c.Arg("args", "command and arguments, use -- before flags").Required().StringsVar(&cmd.args)
+}
+
+func (cmd *ExecCommand) run(c *kingpin.ParseContext) error {
+	ctx, cancel := cmd.context(cmd.logger)
+	defer cancel()
+
+	bc, cleanup, err := newBUCCClientOnAnyNode(ctx, cmd.logger)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	command := append(cmd.prefix, cmd.args...)
+	if cmd.fly {
+		err = bc.Fly(ctx, command)
+	} else {
+		err = bc.Exec(ctx, command)
+	}
+	if err != nil {
+		return exitError(err, fmt.Errorf("failed to run %s: %s", command[0], err))
+	}
+	return nil
+}
+
+// exitError passes on the exit status of container processes as is,
+// any other error is replaced by the given (more descriptive) error.
+func exitError(err, other error) error {
+	if _, ok := err.(*bucc.ExitError); ok {
+		return err
+	}
+	return other
+}
+
+// newBUCCClientOnAnyNode creates a BUCC client which uses the BUCC state
+// stored in etcd when the node is not hosting BUCC itself.
+func newBUCCClientOnAnyNode(ctx context.Context, logger *logrus.Entry) (*bucc.Client, func(), error) {
+	conf, err := config.LoadNodeConfig(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed load node config: %s", err)
+	}
+
+	cc, err := config.LoadClusterConfig(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed load cluster config: %s", err)
+	}
+
+	bc, err := bucc.NewClient(ctx, logger, conf, cc)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed create BUCC client: %s", err)
+	}
+
+	if conf.IsSingletonZone() {
+		return bc, func() { bc.Close() }, nil
+	}
+
+	cleanup, err := bc.UseClusterState(ctx)
+	if err != nil {
+		bc.Close()
+		return nil, nil, fmt.Errorf("failed to load BUCC state: %s", err)
+	}
+	return bc, func() {
+		cleanup()
+		bc.Close()
+	}, nil
+}
@@ -1,10 +1,16 @@
 package commands
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strconv"
 
+	"github.com/docker/docker/client"
+	"github.com/sirupsen/logrus"
+	"github.com/starkandwayne/molten-core/bucc"
 	"github.com/starkandwayne/molten-core/config"
 	"github.com/starkandwayne/molten-core/flannel"
 	"github.com/starkandwayne/molten-core/units"
@@ -13,56 +19,293 @@ import (
 )
 
 type InitCommand struct {
-	logger        *log.Logger
+	logger        *logrus.Entry
 	flannelSubnet string
 	zoneIndex     uint16
 	dev           bool
+	cluster       clusterFlags
+	registryAuth  config.RegistryAuth
+	registryCA    string
+	proxyCert     string
+	proxyKey      string
+	proxyACMECA   string
+	nodeDocker    config.DockerDaemon
+	// agent is set when mc agent deploys BUCC, instead of the oneshot units
+	agent bool
+	deadline
 }
 
 func (cmd *InitCommand) register(app *kingpin.Application) {
 	c := app.Command("init", "bootstrap node into MoltenCore cluster member").Action(cmd.run)
+	cmd.registerFlags(c)
+	cmd.deadline.register(c, "10m")
+}
+
+// registerFlags registers the flags shared by init and agent.
+func (cmd *InitCommand) registerFlags(c *kingpin.CmdClause) {
 	c.Flag("zone", "Index of this node, used for BOSH availability zone").Required().Uint16Var(&cmd.zoneIndex)
 	c.Flag("dev", "Base zone index of last private IP octet").BoolVar(&cmd.dev)
+	cmd.cluster.register(c)
+	c.Flag("registry-username", "Username for the registry mirror").StringVar(&cmd.registryAuth.Username)
+	c.Flag("registry-password", "Password for the registry mirror").Envar("MC_REGISTRY_PASSWORD").StringVar(&cmd.registryAuth.Password)
+	c.Flag("registry-ca", "Path to the CA certificate of the registry mirror").ExistingFileVar(&cmd.registryCA)
+	c.Flag("proxy-cert", "Path to the (wildcard) certificate of the TLS proxy, disables ACME").ExistingFileVar(&cmd.proxyCert)
+	c.Flag("proxy-key", "Path to the private key of the TLS proxy certificate").ExistingFileVar(&cmd.proxyKey)
+	c.Flag("proxy-acme-ca-cert", "Path to the CA certificate of the ACME server (e.g. Pebble)").ExistingFileVar(&cmd.proxyACMECA)
+	c.Flag("node-docker-storage-driver", "Storage driver of the docker daemon on this node, overrides --docker-storage-driver").StringVar(&cmd.nodeDocker.StorageDriver)
+	c.Flag("node-docker-data-root", "Data root of the docker daemon on this node, overrides --docker-data-root").StringVar(&cmd.nodeDocker.DataRoot)
 }
 
 func (cmd *InitCommand) run(c *kingpin.ParseContext) error {
-	cmd.logger.Printf("Generating node config")
-	if cmd.dev {
-		ip, _ := util.LookupIpV4Address(false)
-		lastIPDiget := ip.String()[len(ip.String())-1:]
-		i, _ := strconv.ParseInt(lastIPDiget, 10, 16)
-		cmd.zoneIndex = uint16(i - 1)
-	}
-	conf, err := config.GenereateNodeConfig(cmd.zoneIndex)
+	ctx, cancel := cmd.context(cmd.logger)
+	defer cancel()
+
+	conf, cc, err := cmd.configure(ctx, true)
+	if err != nil {
+		return err
+	}
+	for _, s := range cmd.steps(conf, cc) {
+		if err = s.run(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// configure returns the node and cluster config. Only when apply is set the
+// cluster flags are applied. init (re)generates the node config, the agent
+// reuses the one in etcd and only generates it when there is none, so a
+// restart of the agent does not change the node.
+func (cmd *InitCommand) configure(ctx context.Context, apply bool) (*config.NodeConfig, *config.ClusterConfig, error) {
+	var conf *config.NodeConfig
+	var err error
+	if cmd.agent {
+		conf, err = config.LoadNodeConfig(ctx)
+		if err != nil && err != config.ErrNoNodeConfig {
+			return nil, nil, fmt.Errorf("failed load node config: %s", err)
+		}
+		if conf != nil {
+			renewed, err := conf.RenewDockerCerts(ctx)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to renew docker certs: %s", err)
+			}
+			if renewed {
+				cmd.logger.WithField("phase", "node-config").Info("Renewed docker certs")
+			}
+		}
+	}
+	if conf == nil {
+		cmd.logger.WithField("phase", "node-config").Info("Generating node config")
+		if cmd.dev {
+			ip, _ := util.LookupIpV4Address(false)
+			lastIPDiget := ip.String()[len(ip.String())-1:]
+			i, _ := strconv.ParseInt(lastIPDiget, 10, 16)
+			cmd.zoneIndex = uint16(i - 1)
+		}
+		conf, err = config.GenereateNodeConfig(ctx, cmd.zoneIndex, cmd.nodeDocker)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed generate node config: %s", err)
+		}
+	}
+	cmd.logger = cmd.logger.WithField("zone", conf.Zone())
+
+	cmd.logger.WithField("phase", "cluster-config").Info("Loading cluster config")
+	if !apply {
+		cc, err := config.LoadClusterConfig(ctx)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed load cluster config: %s", err)
+		}
+		return conf, cc, nil
+	}
+
+	cc, err := config.UpdateClusterConfig(ctx, func(cc *config.ClusterConfig) (bool, error) {
+		changed, err := cmd.cluster.apply(cc)
+		if err != nil {
+			return false, fmt.Errorf("invalid cluster config: %s", err)
+		}
+		if changed {
+			cmd.logger.WithField("phase", "cluster-config").Info("Updating cluster config")
+		}
+		return changed, nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to update cluster config: %s", err)
+	}
+	return conf, cc, nil
+}
+
+// step is a named part of converging a node.
+type step struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+// steps converge the node with conf towards the desired state, each of them
+// can be repeated.
+func (cmd *InitCommand) steps(conf *config.NodeConfig, cc *config.ClusterConfig) []step {
+	var proxyFiles []units.File
+	return []step{
+		{"registry", func(ctx context.Context) error {
+			if err := cmd.updateRegistryAuth(cc); err != nil {
+				return fmt.Errorf("failed to configure registry auth: %s", err)
+			}
+			return nil
+		}},
+		// reserve the subnet before (re)starting flannel, which waits for it
+		{"flannel", func(ctx context.Context) error {
+			cmd.logger.WithField("phase", "flannel").Info("Configure Flannel subnet")
+			if err := flannel.ConfigureSubnet(ctx, conf.Subnet, conf.PrivateIP); err != nil {
+				return fmt.Errorf("failed to configure flannel subnet: %s", err)
+			}
+			return nil
+		}},
+		{"proxy", func(ctx context.Context) error {
+			if !conf.IsSingletonZone() || !cc.Proxy.Enabled() {
+				return nil
+			}
+			cmd.logger.WithField("phase", "proxy").Infof("Rendering TLS proxy config for %s", cc.Proxy.Domain)
+			if err := os.MkdirAll(filepath.Join(config.ProxyDir, "data"), 0700); err != nil {
+				return fmt.Errorf("failed to create TLS proxy data dir: %s", err)
+			}
+			var err error
+			if proxyFiles, err = renderProxyFiles(conf, cc, cmd.proxyCert, cmd.proxyKey, cmd.proxyACMECA); err != nil {
+				return fmt.Errorf("failed to configure TLS proxy: %s", err)
+			}
+			if err = cmd.pullProxyImage(ctx, cc); err != nil {
+				return fmt.Errorf("failed to pull TLS proxy image: %s", err)
+			}
+			return nil
+		}},
+		{"units", func(ctx context.Context) error {
+			cmd.logger.WithField("phase", "units").Info("Writing MoltenCore managed systemd unit files")
+			u, err := units.NodeUnits(conf, *cc, cmd.agent, proxyFiles)
+			if err != nil {
+				return fmt.Errorf("failed to render systemd units: %s", err)
+			}
+			summary, err := units.Enable(ctx, u, units.NodePaths(conf, *cc))
+			if err != nil {
+				return fmt.Errorf("failed enable systemd units: %s", err)
+			}
+			cmd.logger.WithField("phase", "units").Infof("Systemd units %s", summary)
+			return nil
+		}},
+	}
+}
+
+// updateRegistryAuth stores the registry credentials on the node (not in etcd)
+// and makes docker trust the registry CA.
+func (cmd *InitCommand) updateRegistryAuth(cc *config.ClusterConfig) error {
+	ra, err := config.LoadRegistryAuth()
 	if err != nil {
-		return fmt.Errorf("failed generate node config: %s", err)
+		return err
+	}
+
+	changed := false
+	if cmd.registryAuth.Username != "" && cmd.registryAuth.Username != ra.Username {
+		ra.Username = cmd.registryAuth.Username
+		changed = true
+	}
+	if cmd.registryAuth.Password != "" && cmd.registryAuth.Password != ra.Password {
+		ra.Password = cmd.registryAuth.Password
+		changed = true
+	}
+	if cmd.registryCA != "" {
+		ca, err := ioutil.ReadFile(cmd.registryCA)
+		if err != nil {
+			return fmt.Errorf("failed to read registry CA: %s", err)
+		}
+		if string(ca) != string(ra.CA) {
+			ra.CA = ca
+			changed = true
+		}
+	}
+	if changed {
+		cmd.logger.WithField("phase", "registry").Info("Updating registry auth")
+		if err = ra.Save(); err != nil {
+			return err
+		}
+	}
+
+	if cc.Registry == "" {
+		return nil
 	}
+	cmd.logger.WithField("phase", "registry").Infof("Writing registry CA for %s", cc.RegistryHost())
+	return units.WriteRegistryCA(cc.RegistryHost(), ra.CA)
+}
 
-	cmd.logger.Printf("Writing Docker TLS certs")
-	err = units.WriteDockerTLSCerts(conf.Docker)
+// pullProxyImage pulls the proxy image with the registry credentials, the
+// docker CLI of the proxy unit would pull it without them.
+func (cmd *InitCommand) pullProxyImage(ctx context.Context, cc *config.ClusterConfig) error {
+	dcli, err := util.NewDockerClient(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to write docker certs: %s", err)
+		return err
 	}
+	defer dcli.Close()
 
-	cmd.logger.Printf("Writing MoltenCore managed systemd unit files")
-	u := []units.Unit{
-		units.Flannel(conf),
-		units.DockerTLSSocket(conf.Docker),
-		units.Docker,
+	image := cc.Image(cc.Proxy.Image)
+	_, _, err = dcli.ImageInspectWithRaw(ctx, image)
+	if err == nil {
+		return nil
 	}
-	if conf.IsSingletonZone() {
-		u = append(u, units.BUCC...)
+	if !client.IsErrNotFound(err) {
+		return fmt.Errorf("failed to inspect image %s: %s", image, err)
 	}
 
-	err = units.Enable(u)
+	ra, err := config.LoadRegistryAuth()
 	if err != nil {
-		return fmt.Errorf("failed enable systemd units: %s", err)
+		return err
 	}
+	logger := cmd.logger.WithField("phase", "proxy")
+	logger.Infof("Pulling TLS proxy image %s", image)
+	return util.PullImage(ctx, dcli, logger, image, util.PullAuth{
+		ServerAddress: cc.RegistryHost(),
+		Username:      ra.Username,
+		Password:      ra.Password,
+	})
+}
 
-	cmd.logger.Printf("Configure Flannel subnet")
-	if err = flannel.ConfigureSubnet(conf.Subnet, conf.PrivateIP); err != nil {
-		return fmt.Errorf("failed to configure flannel subnet: %s", err)
+// renderProxyFiles returns the operator supplied certificates and the proxy
+// config for the BUCC node, certificates from earlier runs are reused when no
+// files are given.
+func renderProxyFiles(conf *config.NodeConfig, cc *config.ClusterConfig, certFile, keyFile, acmeCAFile string) ([]units.File, error) {
+	if (certFile == "") != (keyFile == "") {
+		return nil, fmt.Errorf("--proxy-cert and --proxy-key have to be given together")
 	}
 
-	return nil
+	given := make(map[string][]byte)
+	for name, path := range map[string]string{
+		bucc.ProxyCertFile:   certFile,
+		bucc.ProxyKeyFile:    keyFile,
+		bucc.ProxyACMECAFile: acmeCAFile,
+	} {
+		var data []byte
+		if path != "" {
+			var err error
+			if data, err = ioutil.ReadFile(path); err != nil {
+				return nil, fmt.Errorf("failed to read %s: %s", path, err)
+			}
+		}
+		given[name] = data
+	}
+	files, err := units.ProxyFiles(given)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read proxy certificates: %s", err)
+	}
+
+	exists := func(name string) bool {
+		for _, f := range files {
+			if filepath.Base(f.Path) == name {
+				return true
+			}
+		}
+		return false
+	}
+	caddyfile, err := bucc.RenderProxyConfig(conf, *cc, bucc.ProxyTLS{
+		Certificate: exists(bucc.ProxyCertFile) && exists(bucc.ProxyKeyFile),
+		ACMECARoot:  exists(bucc.ProxyACMECAFile),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to render proxy config: %s", err)
+	}
+	return append(files, units.ProxyConfig(caddyfile)), nil
 }
@@ -0,0 +1,32 @@
+package commands
+
+import (
+	"github.com/sirupsen/logrus"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+// configureLogging adds the global logging flags, which are applied to logger
+// before any command runs. Timestamps are left to journald.
+func configureLogging(logger *logrus.Logger, app *kingpin.Application) {
+	// kingpin skips setting defaults when --help is given
+	level, format := "info", "text"
+	app.Flag("log-level", "Minimum level of the messages logged").
+		Default(level).EnumVar(&level, "debug", "info", "warn", "error")
+	app.Flag("log-format", "Format of the log messages").
+		Default(format).EnumVar(&format, "text", "json")
+
+	app.PreAction(func(*kingpin.ParseContext) error {
+		l, err := logrus.ParseLevel(level)
+		if err != nil {
+			return err
+		}
+		logger.SetLevel(l)
+
+		if format == "json" {
+			logger.SetFormatter(&logrus.JSONFormatter{DisableTimestamp: true})
+		} else {
+			logger.SetFormatter(&logrus.TextFormatter{DisableTimestamp: true, DisableColors: true})
+		}
+		return nil
+	})
+}
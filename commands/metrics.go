@@ -0,0 +1,133 @@
+package commands
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/starkandwayne/molten-core/bucc"
+	"github.com/starkandwayne/molten-core/certs"
+	"github.com/starkandwayne/molten-core/config"
+	"github.com/starkandwayne/molten-core/flannel"
+	"github.com/starkandwayne/molten-core/util"
+)
+
+const (
+	// probeTimeout is the time each probe gets, so all of them together
+	// stay within the default Prometheus scrape timeout of 10s
+	probeTimeout = time.Second
+)
+
+// serveMetrics probes the node on each scrape, probes which fail are logged
+// and left out, except for etcd which is reported as unhealthy. Probes do not
+// wait for etcd or docker, a dependency which is down fails its probes fast.
+func (cmd *AgentCommand) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	cmd.mu.Lock()
+	status, conf := cmd.status, cmd.conf
+	configsUpdated, buccDeploys := cmd.configsUpdated, cmd.buccDeploys
+	cmd.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	if conf == nil {
+		// the zone is not known before the node config has been loaded
+		return
+	}
+
+	probe := func() (context.Context, context.CancelFunc) {
+		return context.WithTimeout(r.Context(), probeTimeout)
+	}
+	logger := cmd.logger.WithField("zone", conf.Zone())
+	zone := []string{"zone", conf.Zone()}
+	var m util.Metrics
+
+	m.Gauge("mc_agent_healthy", "Whether the last reconcile pass of mc agent succeeded",
+		boolValue(status.Healthy), zone...)
+	m.Gauge("mc_agent_last_reconcile_timestamp_seconds", "Time the last reconcile pass of mc agent finished",
+		timestamp(status.Finished), zone...)
+
+	for _, c := range []struct {
+		name string
+		cert certs.Cert
+	}{{"ca", conf.Docker.CA}, {"server", conf.Docker.Server}, {"client", conf.Docker.Client}} {
+		notAfter, err := c.cert.NotAfter()
+		if err != nil {
+			logger.Warnf("Failed to read expiry of docker %s certificate: %s", c.name, err)
+			continue
+		}
+		m.Gauge("mc_docker_cert_expiry_timestamp_seconds", "Time the docker TLS certificates of the node expire",
+			timestamp(notAfter), "zone", conf.Zone(), "cert", c.name)
+	}
+
+	ctx, cancel := probe()
+	present, err := flannel.LeasePresent(ctx, conf.Subnet)
+	cancel()
+	if err != nil {
+		logger.Warnf("Failed to check flannel lease: %s", err)
+	} else {
+		m.Gauge("mc_flannel_lease_present", "Whether the flannel subnet of the node is reserved in etcd",
+			boolValue(present), zone...)
+	}
+
+	ctx, cancel = probe()
+	members, leader, err := util.EtcdStatus(ctx)
+	cancel()
+	if err != nil {
+		logger.Warnf("Failed to check etcd: %s", err)
+	} else {
+		m.Gauge("mc_etcd_members", "Number of members of the etcd cluster", float64(members), zone...)
+	}
+	m.Gauge("mc_etcd_healthy", "Whether etcd is reachable and has a leader", boolValue(err == nil && leader), zone...)
+
+	ctx, cancel = probe()
+	dcli, err := util.DialDocker(ctx)
+	cancel()
+	if err != nil {
+		logger.Warnf("Failed to connect to docker: %s", err)
+	} else {
+		defer dcli.Close()
+
+		ctx, cancel = probe()
+		res, err := dcli.NetworkInspect(ctx, config.BOSHDockerNetworkName, types.NetworkInspectOptions{})
+		cancel()
+		if err != nil {
+			logger.Warnf("Failed to inspect network %s: %s", config.BOSHDockerNetworkName, err)
+		} else {
+			m.Gauge("mc_bosh_network_containers", "Number of containers attached to the bosh docker network",
+				float64(len(res.Containers)), zone...)
+		}
+	}
+
+	if conf.IsSingletonZone() {
+		if !configsUpdated.IsZero() {
+			m.Gauge("mc_bosh_configs_last_update_timestamp_seconds", "Time mc agent last updated the BOSH configs",
+				timestamp(configsUpdated), zone...)
+		}
+		m.Counter("mc_bucc_deploys_total", "Number of times mc agent deployed BUCC since it started",
+			float64(buccDeploys), zone...)
+		if dcli != nil {
+			ctx, cancel = probe()
+			restarts, err := bucc.DirectorRestarts(ctx, dcli)
+			cancel()
+			if err != nil {
+				logger.Warnf("Failed to count BUCC director restarts: %s", err)
+			} else {
+				m.Counter("mc_bucc_director_restarts_total", "Number of times docker restarted the BUCC director container",
+					float64(restarts), zone...)
+			}
+		}
+	}
+
+	m.WriteTo(w)
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func timestamp(t time.Time) float64 {
+	return float64(t.UnixNano()) / 1e9
+}
@@ -0,0 +1,71 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/starkandwayne/molten-core/config"
+	"github.com/starkandwayne/molten-core/flannel"
+	"github.com/starkandwayne/molten-core/util"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+type ReconcileNetworkCommand struct {
+	logger       *logrus.Entry
+	drainTimeout time.Duration
+	deadline
+}
+
+func (cmd *ReconcileNetworkCommand) register(app *kingpin.Application) {
+	c := app.Command("reconcile-network", "create or fix the bosh docker network of this node").Action(cmd.run)
+	c.Flag("drain-timeout", "Time containers get to stop before a changed network is recreated").Default("30s").DurationVar(&cmd.drainTimeout)
+	cmd.deadline.register(c, "5m")
+}
+
+func (cmd *ReconcileNetworkCommand) run(c *kingpin.ParseContext) error {
+	ctx, cancel := cmd.context(cmd.logger)
+	defer cancel()
+
+	cmd.logger.Info("Loading node config")
+	conf, err := config.LoadNodeConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("failed load node config: %s", err)
+	}
+	cmd.logger = cmd.logger.WithField("zone", conf.Zone())
+
+	return reconcileNetwork(ctx, cmd.logger, conf, cmd.drainTimeout)
+}
+
+// reconcileNetwork creates or fixes the bosh network of the node with conf.
+func reconcileNetwork(ctx context.Context, logger *logrus.Entry, conf *config.NodeConfig, drainTimeout time.Duration) error {
+	gw, err := conf.Subnet.Host(1)
+	if err != nil {
+		return fmt.Errorf("failed to get gateway ip: %s", err)
+	}
+	mtu, err := flannel.MTU()
+	if err != nil {
+		return err
+	}
+
+	dcli, err := util.NewDockerClient(ctx)
+	if err != nil {
+		return err
+	}
+	defer dcli.Close()
+	created, err := util.ReconcileNetwork(ctx, dcli, logger, util.NetworkSpec{
+		Name:       config.BOSHDockerNetworkName,
+		Subnet:     conf.Subnet.String(),
+		Gateway:    gw.String(),
+		MTU:        mtu,
+		Attachable: true,
+	}, drainTimeout)
+	if err != nil {
+		return err
+	}
+	if !created {
+		logger.Infof("Network %s is up to date", config.BOSHDockerNetworkName)
+	}
+	return nil
+}
@@ -2,34 +2,33 @@ package commands
 
 import (
 	"fmt"
-	"log"
 
-	"github.com/starkandwayne/molten-core/bucc"
-	"github.com/starkandwayne/molten-core/config"
+	"github.com/sirupsen/logrus"
 	kingpin "gopkg.in/alecthomas/kingpin.v2"
 )
 
 type ShellCommand struct {
-	logger *log.Logger
+	logger *logrus.Entry
+	deadline
 }
 
 func (cmd *ShellCommand) register(app *kingpin.Application) {
-	app.Command("shell", "start interactive shell for interacting with BUCC").Action(cmd.run)
+	c := app.Command("shell", "start interactive shell for interacting with BUCC").Action(cmd.run)
+	cmd.deadline.register(c, "0s")
 }
 
 func (cmd *ShellCommand) run(c *kingpin.ParseContext) error {
-	conf, err := config.LoadNodeConfig()
-	if err != nil {
-		return fmt.Errorf("failed load node config: %s", err)
-	}
+	ctx, cancel := cmd.context(cmd.logger)
+	defer cancel()
 
-	bc, err := bucc.NewClient(cmd.logger, conf)
+	bc, cleanup, err := newBUCCClientOnAnyNode(ctx, cmd.logger)
 	if err != nil {
-		return fmt.Errorf("failed create BUCC client: %s", err)
+		return err
 	}
+	defer cleanup()
 
-	if err = bc.Shell(); err != nil {
-		return fmt.Errorf("failed to start shell container: %s", err)
+	if err = bc.Shell(ctx); err != nil {
+		return exitError(err, fmt.Errorf("failed to start shell container: %s", err))
 	}
 	return nil
 }
@@ -0,0 +1,55 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+type StatusCommand struct {
+	logger *logrus.Entry
+	output string
+}
+
+func (cmd *StatusCommand) register(app *kingpin.Application) {
+	c := app.Command("status", "print the result of the last reconcile pass of mc agent").Action(cmd.run)
+	c.Flag("output", "Output format (text or json)").Short('o').Default("text").EnumVar(&cmd.output, "text", "json")
+}
+
+func (cmd *StatusCommand) run(c *kingpin.ParseContext) error {
+	s, err := loadAgentStatus()
+	if err != nil {
+		return err
+	}
+
+	if cmd.output == "json" {
+		raw, err := json.MarshalIndent(s, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal agent status: %s", err)
+		}
+		fmt.Println(string(raw))
+		return nil
+	}
+
+	health := "healthy"
+	if !s.Healthy {
+		health = "unhealthy"
+	}
+	fmt.Printf("Zone %s is %s, last reconciled %s (took %s)\n", s.Zone, health,
+		s.Finished.Format(time.RFC3339), s.Finished.Sub(s.Started).Round(time.Second))
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, step := range s.Steps {
+		result := "ok"
+		if step.Error != "" {
+			result = step.Error
+		}
+		fmt.Fprintf(w, "  %s\t%s\t%s\n", step.Name, step.Duration, result)
+	}
+	return w.Flush()
+}
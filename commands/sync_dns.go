@@ -0,0 +1,59 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"github.com/starkandwayne/molten-core/bucc"
+	"github.com/starkandwayne/molten-core/config"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+type SyncDNSCommand struct {
+	logger *logrus.Entry
+	deadline
+}
+
+func (cmd *SyncDNSCommand) register(app *kingpin.Application) {
+	c := app.Command("sync-dns", "sync bosh-dns whenever BOSH instances change").Action(cmd.run)
+	cmd.deadline.register(c, "0s")
+}
+
+func (cmd *SyncDNSCommand) run(c *kingpin.ParseContext) error {
+	ctx, cancel := cmd.context(cmd.logger)
+	defer cancel()
+
+	cmd.logger.Info("Loading node config")
+	conf, err := config.LoadNodeConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("failed load node config: %s", err)
+	}
+
+	cmd.logger.Info("Loading cluster config")
+	cc, err := config.LoadClusterConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("failed load cluster config: %s", err)
+	}
+
+	s, err := config.LoadBUCCState(ctx)
+	if err != nil {
+		return err
+	}
+	t, err := bucc.NewTarget(s, *conf, *cc, "")
+	if err != nil {
+		return err
+	}
+	d, err := bucc.NewDirector(t.BOSH)
+	if err != nil {
+		return fmt.Errorf("failed to create director client: %s", err)
+	}
+
+	bc, err := bucc.NewClient(ctx, cmd.logger, conf, cc)
+	if err != nil {
+		return fmt.Errorf("failed create BUCC client: %s", err)
+	}
+	defer bc.Close()
+
+	cmd.logger.Info("Watching BOSH instances for changes")
+	return bc.SyncDNS(ctx, d)
+}
@@ -0,0 +1,84 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"github.com/starkandwayne/molten-core/bucc"
+	"github.com/starkandwayne/molten-core/config"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+type TargetCommand struct {
+	logger        *logrus.Entry
+	output        string
+	sshPrivateKey string
+	sshUser       string
+	deadline
+}
+
+func (cmd *TargetCommand) register(app *kingpin.Application) {
+	c := app.Command("target", "print BOSH, CredHub and Concourse credentials for use from a workstation").Action(cmd.run)
+	c.Flag("output", "Output format (env, json, fly or yaml)").Short('o').Default("env").EnumVar(&cmd.output, "env", "json", "fly", "yaml")
+	c.Flag("ssh-private-key", "Path (on the workstation) of the ssh key for proxying BOSH and CredHub through the BUCC node").StringVar(&cmd.sshPrivateKey)
+	c.Flag("ssh-user", "User for proxying BOSH and CredHub through the BUCC node").Default("core").StringVar(&cmd.sshUser)
+	cmd.deadline.register(c, "1m")
+}
+
+func (cmd *TargetCommand) run(c *kingpin.ParseContext) error {
+	ctx, cancel := cmd.context(cmd.logger)
+	defer cancel()
+
+	s, err := config.LoadBUCCState(ctx)
+	if err != nil {
+		return err
+	}
+
+	confs, err := config.LoadNodeConfigs(ctx)
+	if err != nil {
+		return fmt.Errorf("failed load node configs: %s", err)
+	}
+
+	var node *config.NodeConfig
+	for i, conf := range *confs {
+		if conf.PrivateIP.Equal(s.Host) {
+			node = &(*confs)[i]
+		}
+	}
+	if node == nil {
+		return fmt.Errorf("failed to find node config for BUCC host %s", s.Host)
+	}
+
+	proxy := ""
+	if cmd.sshPrivateKey != "" {
+		proxy = fmt.Sprintf("ssh+socks5://%s@%s:22?private-key=%s", cmd.sshUser, node.PublicIP, cmd.sshPrivateKey)
+	}
+
+	cc, err := config.LoadClusterConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("failed load cluster config: %s", err)
+	}
+
+	t, err := bucc.NewTarget(s, *node, *cc, proxy)
+	if err != nil {
+		return err
+	}
+
+	var out string
+	switch cmd.output {
+	case "env":
+		out = t.Env()
+	case "fly":
+		out = t.Fly()
+	case "json":
+		out, err = t.JSON()
+	case "yaml":
+		out, err = t.YAML()
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Print(out)
+	return nil
+}
@@ -0,0 +1,76 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"github.com/starkandwayne/molten-core/config"
+	"github.com/starkandwayne/molten-core/flannel"
+	"github.com/starkandwayne/molten-core/units"
+	"github.com/starkandwayne/molten-core/util"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+type UninstallCommand struct {
+	logger   *logrus.Entry
+	keepEtcd bool
+	deadline
+}
+
+func (cmd *UninstallCommand) register(app *kingpin.Application) {
+	c := app.Command("uninstall", "remove everything mc init created on this node").Action(cmd.run)
+	c.Flag("keep-etcd", "Keep the node registered in etcd").BoolVar(&cmd.keepEtcd)
+	cmd.deadline.register(c, "10m")
+}
+
+func (cmd *UninstallCommand) run(c *kingpin.ParseContext) error {
+	ctx, cancel := cmd.context(cmd.logger)
+	defer cancel()
+
+	cmd.logger.Info("Loading node config")
+	conf, err := config.LoadNodeConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("failed load node config: %s", err)
+	}
+	cmd.logger = cmd.logger.WithField("zone", conf.Zone())
+
+	// the agent would reinstall what is removed below
+	cmd.logger.WithField("phase", "agent").Infof("Stopping and disabling %s", units.AgentUnit)
+	if err = units.DisableAgent(ctx); err != nil {
+		return err
+	}
+
+	// docker still runs with the mc drop-ins at this point
+	cmd.logger.WithField("phase", "docker").Infof("Removing Docker network %s", config.BOSHDockerNetworkName)
+	dcli, err := util.NewDockerClient(ctx)
+	if err != nil {
+		return err
+	}
+	defer dcli.Close()
+	if err = util.RemoveNetwork(ctx, dcli, cmd.logger, config.BOSHDockerNetworkName); err != nil {
+		return err
+	}
+
+	cmd.logger.WithField("phase", "units").Info("Removing MoltenCore managed systemd units and files")
+	summary, err := units.Uninstall(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to uninstall systemd units: %s", err)
+	}
+	cmd.logger.WithField("phase", "units").Infof("Systemd units %s", summary)
+
+	if cmd.keepEtcd {
+		return nil
+	}
+
+	cmd.logger.WithField("phase", "etcd").Info("Deregistering node from etcd")
+	if err = flannel.ReleaseSubnet(ctx, conf.Subnet); err != nil {
+		return fmt.Errorf("failed to release flannel subnet: %s", err)
+	}
+	if err = config.DeleteBUCCState(ctx, conf.PrivateIP); err != nil {
+		return err
+	}
+	if err = conf.Delete(ctx); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package commands
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+	"github.com/starkandwayne/molten-core/config"
+	"github.com/starkandwayne/molten-core/units"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+type UnitsRenderCommand struct {
+	logger    *logrus.Entry
+	zone      string
+	privateIP net.IP
+	outputDir string
+	diff      bool
+	agent     bool
+	deadline
+}
+
+func (cmd *UnitsRenderCommand) register(app *kingpin.Application) {
+	c := app.Command("units", "inspect the systemd units managed by mc")
+	r := c.Command("render", "print the systemd units mc init writes for a node").Action(cmd.run)
+	r.Flag("zone", "Render for a sample node with this zone index, instead of the config of this node in etcd").PlaceHolder("N").StringVar(&cmd.zone)
+	r.Flag("private-ip", "Private IP of the sample node").Default("10.0.0.10").IPVar(&cmd.privateIP)
+	r.Flag("output-dir", "Write the units to this dir instead of stdout").StringVar(&cmd.outputDir)
+	r.Flag("agent", "Render the units of a node running mc agent").BoolVar(&cmd.agent)
+	r.Flag("diff", "Show the differences with the units in "+units.ConfigDir("/")).BoolVar(&cmd.diff)
+	cmd.deadline.register(r, "1m")
+}
+
+func (cmd *UnitsRenderCommand) run(c *kingpin.ParseContext) error {
+	ctx, cancel := cmd.context(cmd.logger)
+	defer cancel()
+
+	var conf *config.NodeConfig
+	var cc *config.ClusterConfig
+	var err error
+	if cmd.zone != "" {
+		index, err := strconv.ParseUint(cmd.zone, 10, 16)
+		if err != nil {
+			return fmt.Errorf("invalid zone index %s: %s", cmd.zone, err)
+		}
+		conf, err = config.SampleNodeConfig(uint16(index), cmd.privateIP)
+		if err != nil {
+			return fmt.Errorf("failed to generate sample node config: %s", err)
+		}
+		d := config.DefaultClusterConfig()
+		cc = &d
+	} else {
+		if conf, err = config.LoadNodeConfig(ctx); err != nil {
+			return fmt.Errorf("failed load node config: %s", err)
+		}
+		if cc, err = config.LoadClusterConfig(ctx); err != nil {
+			return fmt.Errorf("failed load cluster config: %s", err)
+		}
+	}
+
+	var proxyFiles []units.File
+	if conf.IsSingletonZone() && cc.Proxy.Enabled() {
+		if proxyFiles, err = renderProxyFiles(conf, cc, "", "", ""); err != nil {
+			return fmt.Errorf("failed to render TLS proxy config: %s", err)
+		}
+	}
+	u, err := units.NodeUnits(conf, *cc, cmd.agent, proxyFiles)
+	if err != nil {
+		return fmt.Errorf("failed to render systemd units: %s", err)
+	}
+	files, err := units.Render(u)
+	if err != nil {
+		return fmt.Errorf("failed to render systemd units: %s", err)
+	}
+	configFiles := units.RenderFiles(u)
+
+	if cmd.outputDir == "" && !cmd.diff {
+		var paths []string
+		for path := range files {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		for _, path := range paths {
+			fmt.Printf("# %s\n%s\n", path, files[path])
+		}
+		for _, f := range configFiles {
+			if f.Secret() {
+				fmt.Printf("# %s (secret, %d bytes)\n\n", f.Path, len(f.Contents))
+				continue
+			}
+			fmt.Printf("# %s\n%s\n", f.Path, f.Contents)
+		}
+		return nil
+	}
+
+	dir := cmd.outputDir
+	if dir == "" {
+		if dir, err = ioutil.TempDir("", "mc-units"); err != nil {
+			return fmt.Errorf("failed to create temp dir: %s", err)
+		}
+		defer os.RemoveAll(dir)
+	}
+	for path, data := range files {
+		if err = writeRendered(filepath.Join(dir, path), data, 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %s", path, err)
+		}
+	}
+	// config files keep their path on the node below a files dir
+	filesDir := filepath.Join(dir, "files")
+	for _, f := range configFiles {
+		mode := f.Mode
+		if mode == 0 {
+			mode = 0644
+		}
+		if err = writeRendered(filepath.Join(filesDir, f.Path), f.Contents, mode); err != nil {
+			return fmt.Errorf("failed to write %s: %s", f.Path, err)
+		}
+	}
+
+	if !cmd.diff {
+		return nil
+	}
+	if err = diffDirs(units.ConfigDir("/"), dir, "files"); err != nil {
+		return err
+	}
+	for _, f := range configFiles {
+		if err = diffFile(f.Path, filepath.Join(filesDir, f.Path), f.Secret()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeRendered(path string, data []byte, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, mode)
+}
+
+// diffDirs prints a unified diff from current to rendered, like diff itself
+// differences are not an error. Files matching exclude are skipped.
+func diffDirs(current, rendered, exclude string) error {
+	return runDiff(current, rendered, "-ruN", "--exclude="+exclude)
+}
+
+// diffFile prints a unified diff from current to rendered, secrets are only
+// reported to differ.
+func diffFile(current, rendered string, secret bool) error {
+	if secret {
+		return runDiff(current, rendered, "-qN")
+	}
+	return runDiff(current, rendered, "-uN")
+}
+
+func runDiff(current, rendered string, flags ...string) error {
+	diff := exec.Command("diff", append(flags, current, rendered)...)
+	diff.Stdout = os.Stdout
+	diff.Stderr = os.Stderr
+	err := diff.Run()
+	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to diff %s with %s: %s", current, rendered, err)
+	}
+	return nil
+}
@@ -1,57 +1,76 @@
 package commands
 
 import (
+	"context"
 	"fmt"
-	"log"
 
+	"github.com/sirupsen/logrus"
 	"github.com/starkandwayne/molten-core/bucc"
 	"github.com/starkandwayne/molten-core/config"
 	kingpin "gopkg.in/alecthomas/kingpin.v2"
 )
 
 type UpdateBUCCConfigsCommand struct {
-	logger *log.Logger
+	logger *logrus.Entry
+	deadline
 }
 
 func (cmd *UpdateBUCCConfigsCommand) register(app *kingpin.Application) {
-	app.Command("update-bucc-configs", "update configs in BOSH and Credhub ").Action(cmd.run)
+	c := app.Command("update-bucc-configs", "update configs in BOSH and Credhub ").Action(cmd.run)
+	cmd.deadline.register(c, "15m")
 }
 
 func (cmd *UpdateBUCCConfigsCommand) run(c *kingpin.ParseContext) error {
-	cmd.logger.Printf("Loading node config")
-	conf, err := config.LoadNodeConfig()
+	ctx, cancel := cmd.context(cmd.logger)
+	defer cancel()
+
+	cmd.logger.Info("Loading node config")
+	conf, err := config.LoadNodeConfig(ctx)
 	if err != nil {
 		return fmt.Errorf("failed load node config: %s", err)
 	}
 
-	cmd.logger.Printf("Loading node configs")
-	confs, err := config.LoadNodeConfigs()
+	cmd.logger.Info("Loading node configs")
+	confs, err := config.LoadNodeConfigs(ctx)
 	if err != nil {
 		return fmt.Errorf("failed load node configs: %s", err)
 	}
 
-	bc, err := bucc.NewClient(cmd.logger, conf)
+	cmd.logger.Info("Loading cluster config")
+	cc, err := config.LoadClusterConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("failed load cluster config: %s", err)
+	}
+
+	return updateBUCCConfigs(ctx, cmd.logger, conf, confs, cc)
+}
+
+// updateBUCCConfigs updates the BOSH configs and the MoltenCore config in
+// Credhub for the nodes with confs.
+func updateBUCCConfigs(ctx context.Context, logger *logrus.Entry, conf *config.NodeConfig, confs *[]config.NodeConfig, cc *config.ClusterConfig) error {
+	bc, err := bucc.NewClient(ctx, logger, conf, cc)
 	if err != nil {
 		return fmt.Errorf("failed create BUCC client: %s", err)
 	}
+	defer bc.Close()
 
-	cmd.logger.Printf("Updating BOSH Cloud Config")
-	if err = bc.UpdateCloudConfig(confs); err != nil {
+	logger.WithField("phase", "cloud-config").Info("Updating BOSH Cloud Config")
+	if err = bc.UpdateCloudConfig(ctx, confs); err != nil {
 		return fmt.Errorf("failed to update BOSH Cloud Config: %s", err)
 	}
 
-	cmd.logger.Printf("Updating BOSH CPI Config")
-	if err = bc.UpdateCPIConfig(confs); err != nil {
+	logger.WithField("phase", "cpi-config").Info("Updating BOSH CPI Config")
+	if err = bc.UpdateCPIConfig(ctx, confs); err != nil {
 		return fmt.Errorf("failed to update BOSH CPI Config: %s", err)
 	}
 
-	cmd.logger.Printf("Updating BOSH Runtime Config")
-	if err = bc.UpdateRuntimeConfig(confs); err != nil {
+	logger.WithField("phase", "runtime-config").Info("Updating BOSH Runtime Config")
+	if err = bc.UpdateRuntimeConfig(ctx); err != nil {
 		return fmt.Errorf("failed to update BOSH Runtime Config: %s", err)
 	}
 
-	cmd.logger.Printf("Updating Credhub MoltenCore Config (for consumption via Concourse)")
-	if err = bc.UpdateMoltenCoreConfig(confs); err != nil {
+	logger.WithField("phase", "moltencore-config").Info("Updating Credhub MoltenCore Config (for consumption via Concourse)")
+	if err = bc.UpdateMoltenCoreConfig(ctx, confs); err != nil {
 		return fmt.Errorf("failed to update Credhub MoltenCore Config: %s", err)
 	}
 
@@ -0,0 +1,93 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+
+	"github.com/starkandwayne/molten-core/util"
+
+	"go.etcd.io/etcd/client"
+)
+
+const (
+	etcdBUCCStatePath string = "/moltencore/bucc"
+)
+
+// BUCCState holds what is needed to talk to BUCC from any node,
+// the host running BUCC, the vars and the client creds generated by bucc up.
+type BUCCState struct {
+	Host  net.IP
+	Vars  []byte
+	Creds []byte
+}
+
+func LoadBUCCState(ctx context.Context) (*BUCCState, error) {
+	kapi, err := util.NewEtcdV2KeysAPI()
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := kapi.Get(ctx, etcdBUCCStatePath, nil)
+	if client.IsKeyNotFound(err) {
+		return nil, fmt.Errorf("BUCC state not found in etcd, has bucc-up completed on z0?")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load BUCC state from etcd: %s", err)
+	}
+
+	var s BUCCState
+	err = json.Unmarshal([]byte(resp.Node.Value), &s)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal BUCC state: %s", err)
+	}
+	return &s, nil
+}
+
+func (s BUCCState) Save(ctx context.Context) error {
+	kapi, err := util.NewEtcdV2KeysAPI()
+	if err != nil {
+		return err
+	}
+
+	raw, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("failed to marshal BUCC state: %s", err)
+	}
+	_, err = kapi.Set(ctx, etcdBUCCStatePath, string(raw), nil)
+	if err != nil {
+		return fmt.Errorf("failed to update BUCC state in etcd: %s", err)
+	}
+	return nil
+}
+
+// DeleteBUCCState removes the BUCC state from etcd, when BUCC runs on host.
+func DeleteBUCCState(ctx context.Context, host net.IP) error {
+	kapi, err := util.NewEtcdV2KeysAPI()
+	if err != nil {
+		return err
+	}
+
+	resp, err := kapi.Get(ctx, etcdBUCCStatePath, nil)
+	if client.IsKeyNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load BUCC state from etcd: %s", err)
+	}
+
+	var s BUCCState
+	if err = json.Unmarshal([]byte(resp.Node.Value), &s); err != nil {
+		return fmt.Errorf("failed to unmarshal BUCC state: %s", err)
+	}
+	if !s.Host.Equal(host) {
+		return nil
+	}
+
+	_, err = kapi.Delete(ctx, etcdBUCCStatePath, &client.DeleteOptions{PrevIndex: resp.Node.ModifiedIndex})
+	if err != nil && !client.IsKeyNotFound(err) {
+		return fmt.Errorf("failed to delete BUCC state from etcd: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,244 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"path"
+	"strings"
+
+	"github.com/starkandwayne/molten-core/flannel"
+	"github.com/starkandwayne/molten-core/util"
+
+	"go.etcd.io/etcd/client"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	etcdClusterConfigPath string = "/moltencore/cluster"
+	blobstorePort                = 8091
+)
+
+type Release struct {
+	Name    string
+	Version string
+	URL     string
+	SHA1    string
+}
+
+type RuntimeConfig struct {
+	DNSRecursors []string
+	BOSHDNS      Release
+	Addons       []json.RawMessage
+	Releases     []json.RawMessage
+	Variables    []json.RawMessage
+}
+
+type Offline struct {
+	Enabled            bool
+	ImageArchive       string
+	ImageArchiveSHA256 string
+	BlobstoreURL       string
+}
+
+type BUCC struct {
+	DirectorName  string
+	Alias         string
+	ConcoursePort int
+	UAAPort       int
+	IPHostIndex   int
+}
+
+// InternalIP returns the address of the BOSH director in the BUCC node subnet.
+func (b BUCC) InternalIP(s flannel.Subnet) (net.IP, error) {
+	return s.Host(b.IPHostIndex)
+}
+
+// Proxy exposes Concourse, UAA and CredHub as subdomains of Domain,
+// certificates are obtained via ACME unless supplied by the operator.
+type Proxy struct {
+	Domain    string
+	Image     string
+	ACMEEmail string
+	ACMECA    string
+}
+
+func (p Proxy) Enabled() bool {
+	return p.Domain != ""
+}
+
+type ClusterConfig struct {
+	Runtime      RuntimeConfig
+	Offline      Offline
+	Registry     string
+	BUCCImage    string
+	BUCC         BUCC
+	Proxy        Proxy
+	DockerDaemon DockerDaemon
+}
+
+// NodeDockerDaemon returns the docker daemon settings of node nc.
+func (cc ClusterConfig) NodeDockerDaemon(nc NodeConfig) DockerDaemon {
+	return cc.DockerDaemon.Override(nc.DockerDaemon)
+}
+
+// BUCCImageOrDefault returns the BUCC image override, if any.
+func (cc ClusterConfig) BUCCImageOrDefault(image string) string {
+	if cc.BUCCImage != "" {
+		return cc.BUCCImage
+	}
+	return image
+}
+
+// Image returns the reference used to pull image, via the registry mirror
+// when one has been configured.
+func (cc ClusterConfig) Image(image string) string {
+	if cc.Registry == "" {
+		return image
+	}
+	return path.Join(cc.Registry, image)
+}
+
+// BlobstoreURL returns the location releases and stemcells are served from in
+// offline mode, by default this is the blobstore served by the BUCC node.
+func (cc ClusterConfig) BlobstoreURL(bucc NodeConfig) string {
+	if cc.Offline.BlobstoreURL != "" {
+		return strings.TrimSuffix(cc.Offline.BlobstoreURL, "/")
+	}
+	return fmt.Sprintf("http://%s", BlobstoreListenAddress(bucc))
+}
+
+// ServesBlobstore reports whether the node should run the local blobstore.
+func (cc ClusterConfig) ServesBlobstore(nc NodeConfig) bool {
+	return cc.Offline.Enabled && cc.Offline.BlobstoreURL == "" && nc.IsSingletonZone()
+}
+
+func BlobstoreListenAddress(nc NodeConfig) string {
+	return fmt.Sprintf("%s:%d", nc.PrivateIP, blobstorePort)
+}
+
+func DefaultClusterConfig() ClusterConfig {
+	return ClusterConfig{
+		BUCC: BUCC{
+			DirectorName:  "moltencore",
+			Alias:         "mc",
+			ConcoursePort: 1443,
+			UAAPort:       1444,
+			IPHostIndex:   10,
+		},
+		Proxy: Proxy{
+			Image: "caddy:2.0.0",
+		},
+		DockerDaemon: defaultDockerDaemon(),
+		Runtime: RuntimeConfig{
+			BOSHDNS: Release{
+				Name:    "bosh-dns",
+				Version: "1.17.0",
+				URL:     "https://bosh.io/d/github.com/cloudfoundry/bosh-dns-release?v=1.17.0",
+				SHA1:    "d514ab3ae376778e106e17c22b78a8705690ae1d",
+			},
+		},
+	}
+}
+
+// LoadClusterConfig returns the cluster wide settings stored in etcd,
+// falling back to the defaults for anything which has not been configured.
+func LoadClusterConfig(ctx context.Context) (*ClusterConfig, error) {
+	kapi, err := util.NewEtcdV2KeysAPI()
+	if err != nil {
+		return nil, err
+	}
+
+	c, _, err := loadClusterConfig(ctx, kapi)
+	return c, err
+}
+
+// loadClusterConfig also returns the etcd index of the cluster config, which
+// is 0 when it has not been stored yet.
+func loadClusterConfig(ctx context.Context, kapi client.KeysAPI) (*ClusterConfig, uint64, error) {
+	c := DefaultClusterConfig()
+	resp, err := kapi.Get(ctx, etcdClusterConfigPath, nil)
+	if client.IsKeyNotFound(err) {
+		return &c, 0, nil
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to load cluster config from etcd: %s", err)
+	}
+
+	err = json.Unmarshal([]byte(resp.Node.Value), &c)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to unmarshal cluster config: %s", err)
+	}
+	return &c, resp.Node.ModifiedIndex, nil
+}
+
+// UpdateClusterConfig applies update to the cluster config stored in etcd
+// and saves it when update reports a change. The config is only replaced when
+// nobody else changed it in the meantime, otherwise update is applied again
+// to the reloaded config.
+func UpdateClusterConfig(ctx context.Context, update func(*ClusterConfig) (bool, error)) (*ClusterConfig, error) {
+	kapi, err := util.NewEtcdV2KeysAPI()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		c, index, err := loadClusterConfig(ctx, kapi)
+		if err != nil {
+			return nil, err
+		}
+		changed, err := update(c)
+		if err != nil {
+			return nil, err
+		}
+		if !changed {
+			return c, nil
+		}
+
+		rawConf, err := json.Marshal(c)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal cluster config: %s", err)
+		}
+		opts := &client.SetOptions{PrevIndex: index}
+		if index == 0 {
+			opts = &client.SetOptions{PrevExist: client.PrevNoExist}
+		}
+		_, err = kapi.Set(ctx, etcdClusterConfigPath, string(rawConf), opts)
+		if isConflict(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to update cluster config in etcd: %s", err)
+		}
+		return c, nil
+	}
+}
+
+// isConflict returns whether a compare-and-swap failed because the key was
+// changed or created concurrently.
+func isConflict(err error) bool {
+	e, ok := err.(client.Error)
+	return ok && (e.Code == client.ErrorCodeTestFailed || e.Code == client.ErrorCodeNodeExist)
+}
+
+// AddAddons merges the addons, releases and variables from a runtime config
+// fragment (YAML or JSON) into the runtime config.
+func (rc *RuntimeConfig) AddAddons(raw []byte) error {
+	var fragment struct {
+		Addons    []json.RawMessage `json:"addons"`
+		Releases  []json.RawMessage `json:"releases"`
+		Variables []json.RawMessage `json:"variables"`
+	}
+	if err := yaml.Unmarshal(raw, &fragment); err != nil {
+		return fmt.Errorf("failed to unmarshal runtime config addons: %s", err)
+	}
+	if len(fragment.Addons) == 0 {
+		return fmt.Errorf("runtime config fragment does not contain any addons")
+	}
+
+	rc.Addons = append(rc.Addons, fragment.Addons...)
+	rc.Releases = append(rc.Releases, fragment.Releases...)
+	rc.Variables = append(rc.Variables, fragment.Variables...)
+	return nil
+}
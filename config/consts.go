@@ -2,4 +2,7 @@ package config
 
 const (
 	BOSHDockerNetworkName = "bosh"
+	ProxyDir              = "/var/lib/moltencore/proxy"
+	BUCCStateDir          = "/var/lib/moltencore/bucc"
+	RegistryAuthFile      = "/var/lib/moltencore/registry-auth.json"
 )
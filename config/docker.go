@@ -0,0 +1,118 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/starkandwayne/molten-core/flannel"
+)
+
+// DockerDaemon configures the docker daemon of the nodes. The settings of a
+// node config override those of the cluster config, when set.
+type DockerDaemon struct {
+	// BridgeIP is the address and network of the default bridge (--bip).
+	BridgeIP string
+	MTU      int
+	// IPMasq can only be set for the cluster.
+	IPMasq        bool
+	StorageDriver string
+	DataRoot      string
+	LogDriver     string
+	LogMaxSize    string
+	LogMaxFile    int
+}
+
+func defaultDockerDaemon() DockerDaemon {
+	return DockerDaemon{
+		// 10.255.240.0/20 last network /20 from 10.0.0.0/8 range
+		// bridge only support 1000 hosts so no need for big network
+		// docker default 172.17.0.0/16 conflicts with virtual box (coreos-vagrant)
+		BridgeIP:   "10.255.240.1/20",
+		MTU:        1500,
+		IPMasq:     true,
+		LogDriver:  "json-file",
+		LogMaxSize: "50m",
+		LogMaxFile: 3,
+	}
+}
+
+// Override returns d with the settings which have been set in o.
+func (d DockerDaemon) Override(o DockerDaemon) DockerDaemon {
+	if o.BridgeIP != "" {
+		d.BridgeIP = o.BridgeIP
+	}
+	if o.MTU != 0 {
+		d.MTU = o.MTU
+	}
+	if o.StorageDriver != "" {
+		d.StorageDriver = o.StorageDriver
+	}
+	if o.DataRoot != "" {
+		d.DataRoot = o.DataRoot
+	}
+	if o.LogDriver != "" {
+		d.LogDriver = o.LogDriver
+	}
+	if o.LogMaxSize != "" {
+		d.LogMaxSize = o.LogMaxSize
+	}
+	if o.LogMaxFile != 0 {
+		d.LogMaxFile = o.LogMaxFile
+	}
+	return d
+}
+
+// Validate checks the settings, the default bridge may not overlap the
+// flannel network since both are routed on the node.
+func (d DockerDaemon) Validate() error {
+	ip, bridge, err := net.ParseCIDR(d.BridgeIP)
+	if err != nil {
+		return fmt.Errorf("invalid docker bridge ip %s: %s", d.BridgeIP, err)
+	}
+	if ip.Equal(bridge.IP) {
+		return fmt.Errorf("docker bridge ip %s is a network address, use a host address (e.g. .1)", d.BridgeIP)
+	}
+	if bridge.Contains(flannel.FlannelNetwork.IP) || flannel.FlannelNetwork.Contains(bridge.IP) {
+		return fmt.Errorf("docker bridge %s overlaps the flannel network %s", bridge, flannel.FlannelNetwork)
+	}
+	if d.MTU < 576 || d.MTU > 9216 {
+		return fmt.Errorf("invalid docker mtu %d, has to be between 576 and 9216", d.MTU)
+	}
+	if d.LogMaxFile < 0 {
+		return fmt.Errorf("invalid docker log max file %d", d.LogMaxFile)
+	}
+	return nil
+}
+
+// DaemonJSON renders the settings which go into /etc/docker/daemon.json,
+// the bridge is configured via the flannel docker options instead.
+func (d DockerDaemon) DaemonJSON() ([]byte, error) {
+	conf := make(map[string]interface{})
+	if d.StorageDriver != "" {
+		conf["storage-driver"] = d.StorageDriver
+	}
+	if d.DataRoot != "" {
+		conf["data-root"] = d.DataRoot
+	}
+	if d.LogDriver != "" {
+		conf["log-driver"] = d.LogDriver
+	}
+	opts := make(map[string]string)
+	if d.LogMaxSize != "" {
+		opts["max-size"] = d.LogMaxSize
+	}
+	if d.LogMaxFile != 0 {
+		opts["max-file"] = strconv.Itoa(d.LogMaxFile)
+	}
+	if len(opts) != 0 {
+		conf["log-opts"] = opts
+	}
+
+	data, err := json.MarshalIndent(conf, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal docker daemon config: %s", err)
+	}
+	return append(data, '\n'), nil
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
 	"path/filepath"
@@ -21,8 +22,15 @@ const (
 	dockerCertValidFor        = time.Hour * 24 * 365
 	dockerTLSPort             = 2376
 	singletonZoneIndex        = uint16(0)
+
+	// dockerCertRenewBefore is how long before expiry docker certs are renewed
+	dockerCertRenewBefore = time.Hour * 24 * 30
 )
 
+// ErrNoNodeConfig is returned by LoadNodeConfig when the node has not been
+// initialized yet.
+var ErrNoNodeConfig = errors.New("no node config in etcd, has mc init run?")
+
 type Docker struct {
 	Endpoint string
 	CA       certs.Cert
@@ -30,12 +38,24 @@ type Docker struct {
 	Client   certs.Cert
 }
 
+type Capacity struct {
+	CPUs     int
+	MemoryMB int
+}
+
+func (c Capacity) Known() bool {
+	return c.CPUs != 0 || c.MemoryMB != 0
+}
+
 type NodeConfig struct {
 	Subnet    flannel.Subnet
 	ZoneIndex uint16
 	Docker    Docker
 	PrivateIP net.IP
 	PublicIP  net.IP
+	Capacity  Capacity
+	// DockerDaemon overrides the cluster wide docker daemon settings.
+	DockerDaemon DockerDaemon
 }
 
 func (nc NodeConfig) IsSingletonZone() bool {
@@ -50,13 +70,12 @@ func (nc NodeConfig) CPIName() string {
 	return fmt.Sprintf("docker-%s", nc.Zone())
 }
 
-func LoadNodeConfigs() (*[]NodeConfig, error) {
+func LoadNodeConfigs(ctx context.Context) (*[]NodeConfig, error) {
 	kapi, err := util.NewEtcdV2KeysAPI()
 	if err != nil {
 		return nil, err
 	}
 
-	ctx := context.Background()
 	resp, err := kapi.Get(ctx, etcdMolenCorePath, &client.GetOptions{Recursive: true})
 	if err != nil {
 		return nil, fmt.Errorf("failed to load node configs from etcd: %s", err)
@@ -74,7 +93,7 @@ func LoadNodeConfigs() (*[]NodeConfig, error) {
 	return &confs, nil
 }
 
-func LoadNodeConfig() (*NodeConfig, error) {
+func LoadNodeConfig(ctx context.Context) (*NodeConfig, error) {
 	privateIP, err := util.LookupIpV4Address(false)
 	if err != nil {
 		return nil, fmt.Errorf("failed to lookup private node ip: %s", err)
@@ -84,8 +103,10 @@ func LoadNodeConfig() (*NodeConfig, error) {
 	if err != nil {
 		return nil, err
 	}
-	ctx := context.Background()
 	resp, err := kapi.Get(ctx, nodePath(privateIP), nil)
+	if client.IsKeyNotFound(err) {
+		return nil, ErrNoNodeConfig
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to load node config from etcd: %s", err)
 	}
@@ -98,7 +119,7 @@ func LoadNodeConfig() (*NodeConfig, error) {
 	return &c, nil
 }
 
-func GenereateNodeConfig(index uint16) (*NodeConfig, error) {
+func GenereateNodeConfig(ctx context.Context, index uint16, daemon DockerDaemon) (*NodeConfig, error) {
 	privateIP, err := util.LookupIpV4Address(false)
 	if err != nil {
 		return nil, fmt.Errorf("failed to lookup private node ip: %s", err)
@@ -114,15 +135,21 @@ func GenereateNodeConfig(index uint16) (*NodeConfig, error) {
 		return nil, fmt.Errorf("failed to generate docker certs: %s", err)
 	}
 
-	docker, err := newDocker(subnet, privateIP)
+	docker, err := loadOrGenerateDocker(ctx, subnet, privateIP)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate docker certs: %s", err)
+		return nil, err
+	}
+
+	cpus, memoryMB, err := util.LookupCapacity()
+	if err != nil {
+		return nil, fmt.Errorf("failed to lookup node capacity: %s", err)
 	}
 
 	conf := NodeConfig{Subnet: subnet, Docker: docker, ZoneIndex: index,
-		PrivateIP: privateIP, PublicIP: publicIP}
+		PrivateIP: privateIP, PublicIP: publicIP,
+		Capacity: Capacity{CPUs: cpus, MemoryMB: memoryMB}, DockerDaemon: daemon}
 
-	err = conf.save()
+	err = conf.save(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -130,14 +157,12 @@ func GenereateNodeConfig(index uint16) (*NodeConfig, error) {
 	return &conf, nil
 }
 
-func (nc NodeConfig) save() error {
+func (nc NodeConfig) save(ctx context.Context) error {
 	kapi, err := util.NewEtcdV2KeysAPI()
 	if err != nil {
 		return err
 	}
 
-	ctx := context.Background()
-
 	rawConf, err := json.Marshal(nc)
 	if err != nil {
 		return fmt.Errorf("failed to marshal node config: %s", err)
@@ -153,6 +178,68 @@ func nodePath(privateIP net.IP) string {
 	return filepath.Join(etcdMolenCorePath, privateIP.String())
 }
 
+// loadOrGenerateDocker reuses the docker certs of the node stored in etcd,
+// docker keeps serving those until it is restarted. New certs are only
+// generated when there are none or they are about to expire.
+func loadOrGenerateDocker(ctx context.Context, s flannel.Subnet, hostIP net.IP) (Docker, error) {
+	kapi, err := util.NewEtcdV2KeysAPI()
+	if err != nil {
+		return Docker{}, err
+	}
+	resp, err := kapi.Get(ctx, nodePath(hostIP), nil)
+	if err != nil && !client.IsKeyNotFound(err) {
+		return Docker{}, fmt.Errorf("failed to load node config from etcd: %s", err)
+	}
+	if err == nil {
+		var c NodeConfig
+		if err = json.Unmarshal([]byte(resp.Node.Value), &c); err != nil {
+			return Docker{}, fmt.Errorf("failed to unmarshal node config: %s", err)
+		}
+		if c.Docker.usable(hostIP) {
+			return c.Docker, nil
+		}
+	}
+
+	docker, err := newDocker(s, hostIP)
+	if err != nil {
+		return Docker{}, fmt.Errorf("failed to generate docker certs: %s", err)
+	}
+	return docker, nil
+}
+
+// RenewDockerCerts regenerates and stores the docker certs of the node when
+// they are about to expire, it returns whether they have been renewed.
+func (nc *NodeConfig) RenewDockerCerts(ctx context.Context) (bool, error) {
+	if nc.Docker.usable(nc.PrivateIP) {
+		return false, nil
+	}
+
+	docker, err := newDocker(nc.Subnet, nc.PrivateIP)
+	if err != nil {
+		return false, fmt.Errorf("failed to generate docker certs: %s", err)
+	}
+	nc.Docker = docker
+	if err = nc.save(ctx); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// usable reports whether the certs are issued for hostIP and do not expire
+// within dockerCertRenewBefore.
+func (d Docker) usable(hostIP net.IP) bool {
+	if d.Endpoint != fmt.Sprintf("%s:%d", hostIP, dockerTLSPort) {
+		return false
+	}
+	for _, c := range []certs.Cert{d.CA, d.Server, d.Client} {
+		notAfter, err := c.NotAfter()
+		if err != nil || time.Until(notAfter) < dockerCertRenewBefore {
+			return false
+		}
+	}
+	return true
+}
+
 func newDocker(s flannel.Subnet, hostIP net.IP) (Docker, error) {
 	caCert, err := certs.Genereate(certs.GenArg{
 		ValidFor: dockerCertValidFor,
@@ -187,3 +274,29 @@ func newDocker(s flannel.Subnet, hostIP net.IP) (Docker, error) {
 		Client:   clientCert,
 	}, nil
 }
+
+// SampleNodeConfig returns a node config for previewing the node with index,
+// without generating certificates or touching etcd.
+func SampleNodeConfig(index uint16, privateIP net.IP) (*NodeConfig, error) {
+	subnet, err := flannel.GetSubnetByIndex(index)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get subnet for zone index %d: %s", index, err)
+	}
+	return &NodeConfig{Subnet: subnet, ZoneIndex: index,
+		PrivateIP: privateIP, PublicIP: privateIP,
+		Docker: Docker{Endpoint: fmt.Sprintf("%s:%d", privateIP, dockerTLSPort)}}, nil
+}
+
+// Delete deregisters the node from the cluster.
+func (nc NodeConfig) Delete(ctx context.Context) error {
+	kapi, err := util.NewEtcdV2KeysAPI()
+	if err != nil {
+		return err
+	}
+
+	_, err = kapi.Delete(ctx, nodePath(nc.PrivateIP), nil)
+	if err != nil && !client.IsKeyNotFound(err) {
+		return fmt.Errorf("failed to delete node config from etcd: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// RegistryAuth is kept on the node in RegistryAuthFile, since etcd is not
+// authenticated.
+type RegistryAuth struct {
+	Username string
+	Password string
+	CA       []byte
+}
+
+func LoadRegistryAuth() (*RegistryAuth, error) {
+	var ra RegistryAuth
+	data, err := ioutil.ReadFile(RegistryAuthFile)
+	if os.IsNotExist(err) {
+		return &ra, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read registry auth: %s", err)
+	}
+
+	if err = json.Unmarshal(data, &ra); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal registry auth: %s", err)
+	}
+	return &ra, nil
+}
+
+func (ra RegistryAuth) Save() error {
+	if err := os.MkdirAll(filepath.Dir(RegistryAuthFile), 0700); err != nil {
+		return fmt.Errorf("failed to create registry auth dir: %s", err)
+	}
+
+	data, err := json.Marshal(ra)
+	if err != nil {
+		return fmt.Errorf("failed to marshal registry auth: %s", err)
+	}
+
+	tmp := RegistryAuthFile + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write registry auth: %s", err)
+	}
+	return os.Rename(tmp, RegistryAuthFile)
+}
+
+// RegistryHost returns the host (and port) of the registry mirror.
+func (cc ClusterConfig) RegistryHost() string {
+	return strings.SplitN(cc.Registry, "/", 2)[0]
+}
@@ -5,18 +5,23 @@ import (
 	"encoding/json"
 	"fmt"
 	"net"
+	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/apparentlymart/go-cidr/cidr"
 	"github.com/starkandwayne/molten-core/util"
+	"github.com/subosito/gotenv"
 
 	"go.etcd.io/etcd/client"
 )
 
 const (
 	EtcdSubnetsPath string = "/coreos.com/network/subnets"
+	// SubnetEnvFile is written by flanneld once it has acquired its subnet
+	SubnetEnvFile = "/run/flannel/subnet.env"
 )
 
 var (
@@ -36,7 +41,7 @@ func GetSubnetByIndex(i uint16) (Subnet, error) {
 	return Subnet{cidr: s}, nil
 }
 
-func ConfigureSubnet(s Subnet, publicIP net.IP) error {
+func ConfigureSubnet(ctx context.Context, s Subnet, publicIP net.IP) error {
 	kapi, err := util.NewEtcdV2KeysAPI()
 	if err != nil {
 		return err
@@ -48,7 +53,6 @@ func ConfigureSubnet(s Subnet, publicIP net.IP) error {
 		return fmt.Errorf("failed to generate flannel subnet config: %s", err)
 	}
 
-	ctx := context.Background()
 	_, err = kapi.Set(ctx, s.etcdKey(), string(value), &client.SetOptions{
 		TTL: 0 * time.Second})
 	if err != nil {
@@ -58,6 +62,24 @@ func ConfigureSubnet(s Subnet, publicIP net.IP) error {
 	return nil
 }
 
+// MTU returns the MTU of the flannel network, as written by flanneld.
+func MTU() (int, error) {
+	f, err := os.Open(SubnetEnvFile)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %s: %s", SubnetEnvFile, err)
+	}
+	defer f.Close()
+	env, err := gotenv.StrictParse(f)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse %s: %s", SubnetEnvFile, err)
+	}
+	mtu, err := strconv.Atoi(env["FLANNEL_MTU"])
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse FLANNEL_MTU from %s: %s", SubnetEnvFile, err)
+	}
+	return mtu, nil
+}
+
 func (s Subnet) Host(num int) (net.IP, error) {
 	return cidr.Host(s.cidr, num)
 }
@@ -85,3 +107,35 @@ func (s Subnet) etcdKey() string {
 	return filepath.Join(EtcdSubnetsPath,
 		strings.Replace(s.cidr.String(), "/", "-", -1))
 }
+
+// ReleaseSubnet removes the reservation of s made by ConfigureSubnet.
+func ReleaseSubnet(ctx context.Context, s Subnet) error {
+	kapi, err := util.NewEtcdV2KeysAPI()
+	if err != nil {
+		return err
+	}
+
+	_, err = kapi.Delete(ctx, s.etcdKey(), nil)
+	if err != nil && !client.IsKeyNotFound(err) {
+		return fmt.Errorf("failed to delete flannel subnet config from etcd: %s", err)
+	}
+	return nil
+}
+
+// LeasePresent reports whether the subnet reservation of s exists in etcd,
+// without waiting for etcd when it is unavailable.
+func LeasePresent(ctx context.Context, s Subnet) (bool, error) {
+	kapi, err := util.NewEtcdV2ProbeKeysAPI()
+	if err != nil {
+		return false, err
+	}
+
+	_, err = kapi.Get(ctx, s.etcdKey(), nil)
+	if client.IsKeyNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get flannel subnet config from etcd: %s", err)
+	}
+	return true, nil
+}
@@ -1,17 +1,29 @@
 package main
 
 import (
-	"log"
 	"os"
 
+	"github.com/sirupsen/logrus"
 	"github.com/starkandwayne/molten-core/commands"
 	kingpin "gopkg.in/alecthomas/kingpin.v2"
 )
 
+// exitCoder is implemented by errors which carry the exit code of a process
+// run on behalf of mc (e.g. the shell), which is passed on as is.
+type exitCoder interface {
+	ExitCode() int
+}
+
 func main() {
-	logger := log.New(os.Stdout, "", 0)
+	// log to stderr, stdout is reserved for the output of commands like mc bosh
+	logger := logrus.New()
+	logger.SetOutput(os.Stderr)
 
 	app := kingpin.New("mc", "MoltenCore Cli")
 	commands.Configure(logger, app)
-	kingpin.MustParse(app.Parse(os.Args[1:]))
+	_, err := app.Parse(os.Args[1:])
+	if e, ok := err.(exitCoder); ok {
+		os.Exit(e.ExitCode())
+	}
+	kingpin.FatalIfError(err, "")
 }
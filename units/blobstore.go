@@ -0,0 +1,25 @@
+package units
+
+import (
+	"fmt"
+
+	"github.com/coreos/go-systemd/unit"
+	"github.com/starkandwayne/molten-core/config"
+)
+
+func Blobstore(conf *config.NodeConfig) Unit {
+	return Unit{
+		Name: "mc-blobstore.service",
+		Contents: []*unit.UnitOption{
+			unit.NewUnitOption("Unit", "Description", "MoltenCore offline blobstore for releases and stemcells"),
+			unit.NewUnitOption("Unit", "After", "network-online.target"),
+
+			unit.NewUnitOption("Service", "ExecStart",
+				fmt.Sprintf("/opt/bin/mc blobstore --listen=%s", config.BlobstoreListenAddress(*conf))),
+			unit.NewUnitOption("Service", "Restart", "always"),
+			unit.NewUnitOption("Service", "StandardOutput", "journal"),
+
+			unit.NewUnitOption("Install", "WantedBy", "multi-user.target"),
+		},
+	}
+}
@@ -5,11 +5,15 @@ import (
 )
 
 var (
+	// BUCC deploys BUCC on node z0 through a chain of oneshot units, mc agent
+	// deploys BUCC itself and only needs SyncDNS.
 	BUCC []Unit = []Unit{{
-		Name: "bucc.service",
+		Name:       "bucc.service",
+		After:      []string{"docker.service", "mc-bosh-network.service"},
+		Background: true,
 		Contents: []*unit.UnitOption{
 			unit.NewUnitOption("Unit", "Description", "BUCC - BOSH UAA Credhub and Concourse"),
-			unit.NewUnitOption("Unit", "After", "docker.service"),
+			unit.NewUnitOption("Unit", "After", "docker.service mc-bosh-network.service"),
 			unit.NewUnitOption("Unit", "Requires", "docker.service"),
 
 			unit.NewUnitOption("Service", "Type", "oneshot"),
@@ -21,7 +25,9 @@ var (
 		},
 	},
 		{
-			Name: "bucc-configs.service",
+			Name:       "bucc-configs.service",
+			After:      []string{"bucc.service"},
+			Background: true,
 			Contents: []*unit.UnitOption{
 				unit.NewUnitOption("Unit", "Description", "Updates BOSH {cloud,cpi,runtime}-configs"),
 				unit.NewUnitOption("Unit", "After", "bucc.service"),
@@ -35,26 +41,26 @@ var (
 				unit.NewUnitOption("Install", "WantedBy", "multi-user.target"),
 			},
 		},
-		// bucc-sync-dns is a workaround for https://github.com/cloudfoundry/bosh/issues/2103
-		{
-			Name: "bucc-sync-dns.service",
-			Contents: []*unit.UnitOption{
-				unit.NewUnitOption("Unit", "Description", "Forcefully sync bosh-dns"),
-				unit.NewUnitOption("Unit", "After", "bucc.service"),
-				unit.NewUnitOption("Unit", "Requires", "bucc.service"),
-
-				unit.NewUnitOption("Service", "Type", "oneshot"),
-				unit.NewUnitOption("Service", "ExecStart", "/bin/bash -c \"docker exec $(jq -r '.current_vm_cid' /var/lib/moltencore/bucc/state.json) /var/vcap/jobs/director/bin/trigger-one-time-sync-dns\""),
-				unit.NewUnitOption("Service", "StandardOutput", "journal"),
-			},
-		},
-		{
-			Name: "bucc-sync-dns.timer",
-			Contents: []*unit.UnitOption{
-				unit.NewUnitOption("Unit", "Description", "Run sync-dns.service every 30 seconds"),
-
-				unit.NewUnitOption("Timer", "OnCalendar", "*:*:0,30"),
-			},
-		},
+		SyncDNS,
 	}
 )
+
+// SyncDNS is a workaround for https://github.com/cloudfoundry/bosh/issues/2103
+var SyncDNS Unit = Unit{
+	Name:       "bucc-sync-dns.service",
+	After:      []string{"docker.service", "bucc.service"},
+	Background: true,
+	Contents: []*unit.UnitOption{
+		unit.NewUnitOption("Unit", "Description", "Sync bosh-dns when BOSH instances change"),
+		unit.NewUnitOption("Unit", "After", "docker.service bucc.service"),
+		unit.NewUnitOption("Unit", "Requires", "docker.service"),
+
+		unit.NewUnitOption("Service", "ExecStart", "/opt/bin/mc sync-dns"),
+		// the BUCC state is only available once BUCC has been deployed
+		unit.NewUnitOption("Service", "Restart", "always"),
+		unit.NewUnitOption("Service", "RestartSec", "30"),
+		unit.NewUnitOption("Service", "StandardOutput", "journal"),
+
+		unit.NewUnitOption("Install", "WantedBy", "multi-user.target"),
+	},
+}
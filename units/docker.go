@@ -11,25 +11,44 @@ import (
 )
 
 const (
-	dockerSSLDir = "/var/ssl/docker"
+	dockerSSLDir      = "/var/ssl/docker"
+	dockerCertsDDir   = "/etc/docker/certs.d"
+	registryCAFile    = "ca.crt"
+	dockerSocket      = "/run/docker.sock"
+	dockerDaemonJSON  = "/etc/docker/daemon.json"
+	flannelDockerOpts = "/run/flannel/flannel_docker_opts.env"
 )
 
-var (
-	Docker Unit = Unit{
-		Name: "docker.service",
+// Docker configures the docker daemon with d and the TLS certs of tls, the
+// default bridge is set through the docker options file written by flannel.
+func Docker(d config.DockerDaemon, tls config.Docker) (Unit, error) {
+	if err := d.Validate(); err != nil {
+		return Unit{}, err
+	}
+	daemonJSON, err := d.DaemonJSON()
+	if err != nil {
+		return Unit{}, err
+	}
+	return Unit{
+		Name:  "docker.service",
+		After: []string{"flanneld.service", "docker.socket"},
+		Ready: DockerPings(dockerSocket),
+		Files: []File{
+			{Path: dockerDaemonJSON, Contents: daemonJSON},
+			{Path: filepath.Join(dockerSSLDir, "ca.pem"), Contents: tls.CA.Cert},
+			{Path: filepath.Join(dockerSSLDir, "cert.pem"), Contents: tls.Server.Cert},
+			{Path: filepath.Join(dockerSSLDir, "key.pem"), Contents: tls.Server.Key, Mode: 0600},
+		},
 		DropIns: []DropIn{
 			{
 				Name: "60-reset-flannel-default-bridge.conf",
 				Contents: []*unit.UnitOption{
 					unit.NewUnitOption("Service", "ExecStartPre",
-						// 10.255.240.0/20 last network /20 from 10.0.0.0/8 range
-						// bridge only support 1000 hosts so no need for big network
-						// docker default 172.17.0.0/16 conflicts with virtual box (coreos-vagrant)
-						"/bin/sh -c 'echo \"DOCKER_OPT_BIP=\\\\\"--bip=10.255.240.1/20\\\\\"\" > /run/flannel/flannel_docker_opts.env'"),
+						fmt.Sprintf("/bin/sh -c 'echo \"DOCKER_OPT_BIP=\\\\\"--bip=%s\\\\\"\" > %s'", d.BridgeIP, flannelDockerOpts)),
 					unit.NewUnitOption("Service", "ExecStartPre",
-						"/bin/sh -c 'echo \"DOCKER_OPT_IPMASQ=\\\\\"--ip-masq=true\\\\\"\" >> /run/flannel/flannel_docker_opts.env'"),
+						fmt.Sprintf("/bin/sh -c 'echo \"DOCKER_OPT_IPMASQ=\\\\\"--ip-masq=%t\\\\\"\" >> %s'", d.IPMasq, flannelDockerOpts)),
 					unit.NewUnitOption("Service", "ExecStartPre",
-						"/bin/sh -c 'echo \"DOCKER_OPT_MTU=\\\\\"--mtu=1500\\\\\"\" >> /run/flannel/flannel_docker_opts.env'"),
+						fmt.Sprintf("/bin/sh -c 'echo \"DOCKER_OPT_MTU=\\\\\"--mtu=%d\\\\\"\" >> %s'", d.MTU, flannelDockerOpts)),
 				},
 			},
 			{
@@ -40,22 +59,34 @@ var (
 							dockerSSLDir, dockerSSLDir, dockerSSLDir)),
 				},
 			},
-			{
-				Name: "70-create-bosh-network.conf",
-				Contents: []*unit.UnitOption{
-					unit.NewUnitOption("Service", "EnvironmentFile", "/run/flannel/subnet.env"),
-					unit.NewUnitOption("Service", "ExecStartPost",
-						fmt.Sprintf("/bin/sh -c 'docker network create -d bridge --subnet=${FLANNEL_SUBNET} --attachable --opt com.docker.network.driver.mtu=${FLANNEL_MTU} %s || true'",
-							config.BOSHDockerNetworkName)),
-				},
-			},
 		},
-	}
-)
+	}, nil
+}
+
+// BOSHNetwork reconciles the bosh network with the flannel subnet of the
+// node, each time docker has been started.
+var BOSHNetwork Unit = Unit{
+	Name:  "mc-bosh-network.service",
+	After: []string{"docker.service"},
+	Contents: []*unit.UnitOption{
+		unit.NewUnitOption("Unit", "Description", "MoltenCore bosh docker network"),
+		unit.NewUnitOption("Unit", "After", "docker.service flanneld.service"),
+		unit.NewUnitOption("Unit", "Requires", "docker.service"),
+		unit.NewUnitOption("Unit", "PartOf", "docker.service"),
+
+		unit.NewUnitOption("Service", "Type", "oneshot"),
+		unit.NewUnitOption("Service", "ExecStart", "/opt/bin/mc reconcile-network"),
+		unit.NewUnitOption("Service", "RemainAfterExit", "true"),
+		unit.NewUnitOption("Service", "StandardOutput", "journal"),
+
+		unit.NewUnitOption("Install", "WantedBy", "docker.service"),
+	},
+}
 
 func DockerTLSSocket(conf config.Docker) Unit {
 	return Unit{
-		Name: "docker.socket",
+		Name:  "docker.socket",
+		After: []string{"flanneld.service"},
 		DropIns: []DropIn{
 			{
 				Name: "30-listen-stream.conf",
@@ -68,24 +99,20 @@ func DockerTLSSocket(conf config.Docker) Unit {
 	}
 }
 
-func WriteDockerTLSCerts(d config.Docker) error {
-	if err := os.MkdirAll(dockerSSLDir, 0777); err != nil {
-		return err
-	}
-	if err := writeFile("ca.pem", d.CA.Cert); err != nil {
-		return err
-	}
-	if err := writeFile("cert.pem", d.Server.Cert); err != nil {
-		return err
+// WriteRegistryCA makes docker trust the CA of the registry mirror.
+func WriteRegistryCA(host string, ca []byte) error {
+	dir := filepath.Join(dockerCertsDDir, host)
+	if len(ca) == 0 {
+		return os.RemoveAll(dir)
 	}
-	if err := writeFile("key.pem", d.Server.Key); err != nil {
+	if err := os.MkdirAll(dir, 0755); err != nil {
 		return err
 	}
-	return nil
+	return writeFileTo(dir, registryCAFile, ca)
 }
 
-func writeFile(name string, data []byte) error {
-	path := filepath.Join(dockerSSLDir, name)
+func writeFileTo(dir, name string, data []byte) error {
+	path := filepath.Join(dir, name)
 	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
 	if err != nil {
 		return err
@@ -0,0 +1,67 @@
+package units
+
+import (
+	"fmt"
+)
+
+// FakeSystemd keeps the calls made to it in memory, for testing Enable
+// without a systemd.
+type FakeSystemd struct {
+	// Enabled holds the unit files which have been enabled.
+	Enabled []string
+	// Disabled holds the names of the units which have been disabled.
+	Disabled []string
+	Reloads  int
+	// Jobs holds the jobs in the order they were queued, e.g. "restart docker.service".
+	Jobs []string
+	// Results overrides the "done" result of the jobs of a unit.
+	Results map[string]string
+	Journal map[string]string
+}
+
+func (f *FakeSystemd) EnableUnitFiles(paths []string) error {
+	f.Enabled = append(f.Enabled, paths...)
+	return nil
+}
+
+func (f *FakeSystemd) DisableUnitFiles(names []string) error {
+	f.Disabled = append(f.Disabled, names...)
+	return nil
+}
+
+func (f *FakeSystemd) Reload() error {
+	f.Reloads++
+	return nil
+}
+
+func (f *FakeSystemd) StartUnit(name string, ch chan<- string) error {
+	return f.job("start", name, ch)
+}
+
+func (f *FakeSystemd) ReloadOrRestartUnit(name string, ch chan<- string) error {
+	return f.job("restart", name, ch)
+}
+
+func (f *FakeSystemd) TryRestartUnit(name string, ch chan<- string) error {
+	return f.job("try-restart", name, ch)
+}
+
+func (f *FakeSystemd) StopUnit(name string, ch chan<- string) error {
+	return f.job("stop", name, ch)
+}
+
+func (f *FakeSystemd) JournalExcerpt(name string) string {
+	return f.Journal[name]
+}
+
+func (f *FakeSystemd) job(kind, name string, ch chan<- string) error {
+	f.Jobs = append(f.Jobs, fmt.Sprintf("%s %s", kind, name))
+	if ch != nil {
+		result, ok := f.Results[name]
+		if !ok {
+			result = "done"
+		}
+		ch <- result
+	}
+	return nil
+}
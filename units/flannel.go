@@ -16,6 +16,8 @@ const (
 func Flannel(conf *config.NodeConfig) Unit {
 	return Unit{
 		Name: "flanneld.service",
+		// docker reads the flannel subnet from here
+		Ready: SubnetEnvMatches(flannel.SubnetEnvFile, conf.Subnet.String()),
 		DropIns: []DropIn{
 			{
 				Name: "30-mc-flannel.conf",
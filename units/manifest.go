@@ -0,0 +1,194 @@
+package units
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+const (
+	manifestFile = "/etc/mc/manifest.json"
+	// AgentUnit runs mc agent
+	AgentUnit = "mc.service"
+)
+
+// Manifest records what Enable has created on a node, so Uninstall can
+// remove it again.
+type Manifest struct {
+	// Units in the order they have been started.
+	Units []string
+	// Enabled holds the unit files enabled with systemd.
+	Enabled []string
+	// Files holds the unit files, drop-ins and their links.
+	Files []string
+	// Paths holds other files and dirs written by mc, e.g. certificates.
+	Paths []string
+	// Pending holds the units whose restart has not succeeded yet, their
+	// files on disk are already up to date.
+	Pending []string
+}
+
+func (m Manager) manifestPath() string {
+	return filepath.Join(m.Root, manifestFile)
+}
+
+func (m Manager) writeManifest(man Manifest) error {
+	data, err := json.MarshalIndent(man, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest: %s", err)
+	}
+	_, err = writeIfChanged(m.manifestPath(), data, 0644)
+	return err
+}
+
+// pendingRestarts returns the units whose restart failed in the last Enable.
+func (m Manager) pendingRestarts() (map[string]bool, error) {
+	pending := make(map[string]bool)
+	if _, err := os.Stat(m.manifestPath()); os.IsNotExist(err) {
+		return pending, nil
+	}
+	man, err := m.LoadManifest()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range man.Pending {
+		pending[name] = true
+	}
+	return pending, nil
+}
+
+// LoadManifest reads the manifest written by the last Enable.
+func (m Manager) LoadManifest() (*Manifest, error) {
+	data, err := ioutil.ReadFile(m.manifestPath())
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("manifest %s not found, has mc init run on this node?", manifestFile)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %s", err)
+	}
+
+	var man Manifest
+	if err = json.Unmarshal(data, &man); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal manifest: %s", err)
+	}
+	return &man, nil
+}
+
+// DisableAgent stops and disables the unit running mc agent, which would
+// reinstall the units otherwise. It is installed by the Container Linux
+// config, so it is not part of the manifest.
+func DisableAgent(ctx context.Context) error {
+	sd, err := NewDBusSystemd()
+	if err != nil {
+		return err
+	}
+	m := Manager{Root: "/", Systemd: sd}
+	return m.DisableAgent(ctx)
+}
+
+func (m Manager) DisableAgent(ctx context.Context) error {
+	if err := m.Systemd.DisableUnitFiles([]string{AgentUnit}); err != nil {
+		return fmt.Errorf("failed to disable %s: %s", AgentUnit, err)
+	}
+	ch := make(chan string, 1)
+	if err := m.Systemd.StopUnit(AgentUnit, ch); err != nil {
+		return fmt.Errorf("failed to stop %s: %s", AgentUnit, err)
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case result := <-ch:
+		if result != "done" {
+			return fmt.Errorf("failed to stop %s: job %s", AgentUnit, result)
+		}
+	}
+	return nil
+}
+
+// Uninstall stops and disables the units in the manifest and removes
+// everything it lists. Units mc only added drop-ins to are restarted
+// without them, when running.
+func Uninstall(ctx context.Context) (*Summary, error) {
+	sd, err := NewDBusSystemd()
+	if err != nil {
+		return nil, err
+	}
+	m := Manager{Root: "/", Systemd: sd}
+	return m.Uninstall(ctx)
+}
+
+func (m Manager) Uninstall(ctx context.Context) (*Summary, error) {
+	man, err := m.LoadManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	enabled := make(map[string]bool)
+	var names []string
+	for _, path := range man.Enabled {
+		enabled[filepath.Base(path)] = true
+		names = append(names, filepath.Base(path))
+	}
+
+	summary := &Summary{}
+	for i := len(man.Units) - 1; i >= 0; i-- {
+		name := man.Units[i]
+		if !enabled[name] {
+			continue
+		}
+		if err = m.Systemd.StopUnit(name, nil); err != nil {
+			return nil, fmt.Errorf("failed to stop: %s got: %s", name, err)
+		}
+		summary.Stopped = append(summary.Stopped, name)
+	}
+
+	if len(names) != 0 {
+		if err = m.Systemd.DisableUnitFiles(names); err != nil {
+			return nil, fmt.Errorf("failed to disable systemd units: %s", err)
+		}
+	}
+
+	for _, path := range append(man.Files, man.Paths...) {
+		if err = os.RemoveAll(path); err != nil {
+			return nil, fmt.Errorf("failed to remove %s: %s", path, err)
+		}
+		// drop-in dirs are left behind once empty
+		if filepath.Ext(filepath.Dir(path)) == ".d" {
+			os.Remove(filepath.Dir(path))
+		}
+	}
+	if err = os.RemoveAll(ConfigDir(m.Root)); err != nil {
+		return nil, fmt.Errorf("failed to remove %s: %s", mCConfigDir, err)
+	}
+
+	if err = m.Systemd.Reload(); err != nil {
+		return nil, fmt.Errorf("failed to reload systemd: %s", err)
+	}
+
+	for _, name := range man.Units {
+		if enabled[name] {
+			continue
+		}
+		ch := make(chan string, 1)
+		if err = m.Systemd.TryRestartUnit(name, ch); err != nil {
+			return nil, fmt.Errorf("failed to restart: %s got: %s", name, err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case result := <-ch:
+			if result != "done" {
+				return nil, fmt.Errorf("failed to restart: %s got: job %s", name, result)
+			}
+		}
+		summary.Restarted = append(summary.Restarted, name)
+	}
+
+	if err = os.Remove(m.manifestPath()); err != nil {
+		return nil, fmt.Errorf("failed to remove manifest: %s", err)
+	}
+	return summary, nil
+}
@@ -0,0 +1,80 @@
+package units
+
+import (
+	"path/filepath"
+	"sort"
+
+	"github.com/starkandwayne/molten-core/config"
+)
+
+// NodeUnits returns the units mc manages on the node with conf, without the
+// units deploying BUCC when agent is set. proxyFiles are the config and
+// certificates of the TLS proxy.
+func NodeUnits(conf *config.NodeConfig, cc config.ClusterConfig, agent bool, proxyFiles []File) ([]Unit, error) {
+	docker, err := Docker(cc.NodeDockerDaemon(*conf), conf.Docker)
+	if err != nil {
+		return nil, err
+	}
+	u := []Unit{
+		Flannel(conf),
+		DockerTLSSocket(conf.Docker),
+		docker,
+		BOSHNetwork,
+	}
+	if conf.IsSingletonZone() && agent {
+		u = append(u, SyncDNS)
+	} else if conf.IsSingletonZone() {
+		u = append(u, BUCC...)
+	}
+	if conf.IsSingletonZone() && cc.Proxy.Enabled() {
+		u = append(u, Proxy(cc.Image(cc.Proxy.Image), proxyFiles))
+	}
+	if cc.ServesBlobstore(*conf) {
+		u = append(u, Blobstore(conf))
+	}
+	return u, nil
+}
+
+// NodePaths returns the files and dirs, other than units, which mc writes
+// on the node with conf.
+func NodePaths(conf *config.NodeConfig, cc config.ClusterConfig) []string {
+	paths := []string{dockerSSLDir, config.RegistryAuthFile}
+	if cc.Registry != "" {
+		paths = append(paths, filepath.Join(dockerCertsDDir, cc.RegistryHost()))
+	}
+	if conf.IsSingletonZone() {
+		paths = append(paths, config.BUCCStateDir)
+	}
+	if conf.IsSingletonZone() && cc.Proxy.Enabled() {
+		paths = append(paths, config.ProxyDir)
+	}
+	return paths
+}
+
+// Render serializes the units and their drop-ins, keyed by their path
+// relative to the mc config dir.
+func Render(units []Unit) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	for _, u := range units {
+		if err := renderUnit("", u, files); err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// RenderFiles returns the config files read by the units, e.g. certificates,
+// sorted by their path on the node.
+func RenderFiles(units []Unit) []File {
+	var files []File
+	for _, u := range units {
+		files = append(files, u.Files...)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files
+}
+
+// ConfigDir returns the dir below root in which Enable writes the units.
+func ConfigDir(root string) string {
+	return filepath.Join(root, mCConfigDir)
+}
@@ -0,0 +1,80 @@
+package units
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/coreos/go-systemd/unit"
+	"github.com/starkandwayne/molten-core/config"
+)
+
+const (
+	proxyContainerName = "mc-proxy"
+	proxyConfigFile    = "Caddyfile"
+)
+
+// Proxy runs caddy on the host network of the BUCC node, certificates
+// obtained via ACME are kept in the data dir so they survive restarts.
+// Caddy is restarted when its config or certificates in files change.
+func Proxy(image string, files []File) Unit {
+	return Unit{
+		Name:  "mc-proxy.service",
+		After: []string{"docker.service"},
+		Files: files,
+		Contents: []*unit.UnitOption{
+			unit.NewUnitOption("Unit", "Description", "MoltenCore TLS reverse proxy for BUCC"),
+			unit.NewUnitOption("Unit", "After", "docker.service bucc.service"),
+			unit.NewUnitOption("Unit", "Requires", "docker.service"),
+
+			unit.NewUnitOption("Service", "ExecStartPre",
+				fmt.Sprintf("-/usr/bin/docker rm -f %s", proxyContainerName)),
+			unit.NewUnitOption("Service", "ExecStart",
+				fmt.Sprintf("/usr/bin/docker run --rm --name %s --network host -v %s:/etc/caddy:ro -v %s:/data %s",
+					proxyContainerName, config.ProxyDir, filepath.Join(config.ProxyDir, "data"), image)),
+			unit.NewUnitOption("Service", "ExecStop",
+				fmt.Sprintf("/usr/bin/docker stop %s", proxyContainerName)),
+			unit.NewUnitOption("Service", "Restart", "always"),
+			unit.NewUnitOption("Service", "StandardOutput", "journal"),
+
+			unit.NewUnitOption("Install", "WantedBy", "multi-user.target"),
+		},
+	}
+}
+
+// ProxyFiles returns the files in the proxy dir, keyed by name. Files
+// without data are taken from the proxy dir, so operator supplied
+// certificates from earlier runs are kept. Files which do not exist are left
+// out.
+func ProxyFiles(files map[string][]byte) ([]File, error) {
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var out []File
+	for _, name := range names {
+		path := filepath.Join(config.ProxyDir, name)
+		data := files[name]
+		if len(data) == 0 {
+			var err error
+			data, err = ioutil.ReadFile(path)
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		out = append(out, File{Path: path, Contents: data, Mode: 0600})
+	}
+	return out, nil
+}
+
+// ProxyConfig returns the caddy config file.
+func ProxyConfig(caddyfile string) File {
+	return File{Path: filepath.Join(config.ProxyDir, proxyConfigFile), Contents: []byte(caddyfile)}
+}
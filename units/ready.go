@@ -0,0 +1,93 @@
+package units
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/subosito/gotenv"
+)
+
+const (
+	readyInterval = 500 * time.Millisecond
+	readyTimeout  = 2 * time.Minute
+	pingTimeout   = 5 * time.Second
+)
+
+// ReadyCheck returns an error while a unit is not ready to be used, paths
+// are relative to the filesystem root.
+type ReadyCheck func(root string) error
+
+// SubnetEnvMatches is ready once the env file at path, e.g.
+// /run/flannel/subnet.env, holds subnet as FLANNEL_SUBNET. The file written
+// by an earlier flanneld run is still there while flanneld restarts.
+func SubnetEnvMatches(path, subnet string) ReadyCheck {
+	return func(root string) error {
+		f, err := os.Open(filepath.Join(root, path))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		env, err := gotenv.StrictParse(f)
+		if err != nil {
+			return fmt.Errorf("failed to parse %s: %s", path, err)
+		}
+		_, n, err := net.ParseCIDR(env["FLANNEL_SUBNET"])
+		if err != nil {
+			return fmt.Errorf("failed to parse FLANNEL_SUBNET from %s: %s", path, err)
+		}
+		if n.String() != subnet {
+			return fmt.Errorf("%s holds subnet %s instead of %s", path, n, subnet)
+		}
+		return nil
+	}
+}
+
+// DockerPings is ready once the docker daemon answers an API ping on the unix
+// socket at path. The socket itself is held open by docker.socket, even while
+// the daemon is down.
+func DockerPings(path string) ReadyCheck {
+	return func(root string) error {
+		c := http.Client{
+			Timeout: pingTimeout,
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", filepath.Join(root, path))
+				},
+			},
+		}
+		defer c.CloseIdleConnections()
+
+		resp, err := c.Get("http://docker/_ping")
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("docker ping returned %s", resp.Status)
+		}
+		return nil
+	}
+}
+
+func waitReady(ctx context.Context, root string, ready ReadyCheck) error {
+	ctx, cancel := context.WithTimeout(ctx, readyTimeout)
+	defer cancel()
+
+	for {
+		err := ready(root)
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%s (%s)", err, ctx.Err())
+		case <-time.After(readyInterval):
+		}
+	}
+}
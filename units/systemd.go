@@ -0,0 +1,83 @@
+package units
+
+import (
+	"fmt"
+	"os/exec"
+
+	"github.com/coreos/go-systemd/dbus"
+)
+
+const (
+	journalExcerptLines = "20"
+)
+
+// Systemd is the part of systemd used for enabling, (re)starting and
+// removing units.
+// Jobs report their result ("done", "failed", etc.) on ch, when given.
+type Systemd interface {
+	EnableUnitFiles(paths []string) error
+	DisableUnitFiles(names []string) error
+	Reload() error
+	StartUnit(name string, ch chan<- string) error
+	ReloadOrRestartUnit(name string, ch chan<- string) error
+	TryRestartUnit(name string, ch chan<- string) error
+	StopUnit(name string, ch chan<- string) error
+	// JournalExcerpt returns the last journal entries of a unit.
+	JournalExcerpt(name string) string
+}
+
+type dbusSystemd struct {
+	conn *dbus.Conn
+}
+
+// NewDBusSystemd connects to the systemd of this node over D-Bus.
+func NewDBusSystemd() (Systemd, error) {
+	conn, err := dbus.New()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to systemd D-Bus: %s", err)
+	}
+	return &dbusSystemd{conn: conn}, nil
+}
+
+func (s *dbusSystemd) EnableUnitFiles(paths []string) error {
+	_, _, err := s.conn.EnableUnitFiles(paths, false, true)
+	return err
+}
+
+func (s *dbusSystemd) DisableUnitFiles(names []string) error {
+	_, err := s.conn.DisableUnitFiles(names, false)
+	return err
+}
+
+func (s *dbusSystemd) Reload() error {
+	return s.conn.Reload()
+}
+
+func (s *dbusSystemd) StartUnit(name string, ch chan<- string) error {
+	_, err := s.conn.StartUnit(name, "replace", ch)
+	return err
+}
+
+func (s *dbusSystemd) ReloadOrRestartUnit(name string, ch chan<- string) error {
+	_, err := s.conn.ReloadOrRestartUnit(name, "replace", ch)
+	return err
+}
+
+func (s *dbusSystemd) TryRestartUnit(name string, ch chan<- string) error {
+	_, err := s.conn.TryRestartUnit(name, "replace", ch)
+	return err
+}
+
+func (s *dbusSystemd) StopUnit(name string, ch chan<- string) error {
+	_, err := s.conn.StopUnit(name, "replace", ch)
+	return err
+}
+
+func (s *dbusSystemd) JournalExcerpt(name string) string {
+	out, err := exec.Command("journalctl", "--no-pager", "-o", "short",
+		"-n", journalExcerptLines, "-u", name).CombinedOutput()
+	if err != nil {
+		return fmt.Sprintf("failed to read journal: %s", err)
+	}
+	return string(out)
+}
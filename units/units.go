@@ -1,13 +1,16 @@
 package units
 
 import (
+	"context"
+	"crypto/sha256"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
+	"strings"
 
-	"github.com/coreos/go-systemd/dbus"
 	"github.com/coreos/go-systemd/unit"
 )
 
@@ -21,6 +24,27 @@ type Unit struct {
 	Enable   bool
 	Contents []*unit.UnitOption
 	DropIns  []DropIn
+	// After lists the units which Enable has to (re)start first.
+	After []string
+	// Ready is polled after the unit has been (re)started, until it succeeds.
+	Ready ReadyCheck
+	// Background units are not waited for, e.g. long running oneshot units.
+	Background bool
+	// Files are config files read by the unit, it is restarted when they change.
+	Files []File
+}
+
+// File is written to Path below the filesystem root.
+type File struct {
+	Path     string
+	Contents []byte
+	// Mode defaults to 0644.
+	Mode os.FileMode
+}
+
+// Secret reports whether f is only readable by root, e.g. a private key.
+func (f File) Secret() bool {
+	return f.Mode != 0 && f.Mode&0077 == 0
 }
 
 type DropIn struct {
@@ -28,90 +52,369 @@ type DropIn struct {
 	Contents []*unit.UnitOption
 }
 
-func Enable(units []Unit) error {
-	conn, err := dbus.New()
+// Summary reports what Enable has done with each unit.
+type Summary struct {
+	Restarted []string
+	Started   []string
+	Stopped   []string
+}
+
+func (s Summary) String() string {
+	list := func(names []string) string {
+		if len(names) == 0 {
+			return "none"
+		}
+		return strings.Join(names, ", ")
+	}
+	return fmt.Sprintf("restarted: %s; started: %s; stopped: %s",
+		list(s.Restarted), list(s.Started), list(s.Stopped))
+}
+
+// Manager writes units to the filesystem below Root, and (re)starts them.
+type Manager struct {
+	Root    string
+	Systemd Systemd
+	// Paths lists other files and dirs written by mc, which are recorded in
+	// the manifest for Uninstall.
+	Paths []string
+}
+
+// Enable writes and (re)starts units with the systemd of this node.
+func Enable(ctx context.Context, units []Unit, paths []string) (*Summary, error) {
+	sd, err := NewDBusSystemd()
 	if err != nil {
-		return fmt.Errorf("failed to connect to systemd D-Bus: %s", err)
+		return nil, err
 	}
+	m := Manager{Root: "/", Systemd: sd, Paths: paths}
+	return m.Enable(ctx, units)
+}
 
-	if err = os.RemoveAll(mCConfigDir); err != nil {
-		return fmt.Errorf("failed to clear config dir: %s got: %s", mCConfigDir, err)
+// Enable writes the units and their drop-ins, only units whose rendered
+// content differs from what is on disk, or whose restart failed in an
+// earlier Enable, are restarted. Other units are started in case they are
+// not running, units which are no longer configured are stopped.
+func (m Manager) Enable(ctx context.Context, units []Unit) (*Summary, error) {
+	ordered, err := sortUnits(units)
+	if err != nil {
+		return nil, err
 	}
 
-	if err = removeStaleSymlinks(sytemdConfigDir); err != nil {
-		return fmt.Errorf("failed to remove stale symlinks in: %s got: %s", sytemdConfigDir, err)
+	mcDir := ConfigDir(m.Root)
+	systemdDir := filepath.Join(m.Root, sytemdConfigDir)
+
+	desired := make(map[string][]byte)
+	configured := make(map[string]bool)
+	for _, u := range units {
+		if err = renderUnit(mcDir, u, desired); err != nil {
+			return nil, fmt.Errorf("failed to render systemd unit %s got: %s", u.Name, err)
+		}
+		configured[u.Name] = true
+	}
+
+	changed, err := removeStaleFiles(mcDir, desired)
+	if err != nil {
+		return nil, fmt.Errorf("failed to clear config dir: %s got: %s", mCConfigDir, err)
 	}
 
+	for path, data := range desired {
+		written, err := writeIfChanged(path, data, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to write systemd unit file %s got: %s", path, err)
+		}
+		if written {
+			changed[unitName(mcDir, path)] = true
+		}
+	}
+
+	man := Manifest{}
+	for path := range desired {
+		man.Files = append(man.Files, path)
+	}
 	for _, u := range units {
-		if len(u.Contents) != 0 {
-			path := unitPath(mCConfigDir, u)
-			err := writeUnit(path, u.Contents)
-			if err != nil {
-				return fmt.Errorf("failed to write systemd unit file for %s got: %s", u.Name, err)
+		for _, f := range u.Files {
+			path := filepath.Join(m.Root, f.Path)
+			mode := f.Mode
+			if mode == 0 {
+				mode = 0644
 			}
-			_, _, err = conn.EnableUnitFiles([]string{path}, false, true)
+			written, err := writeIfChanged(path, f.Contents, mode)
 			if err != nil {
-				return fmt.Errorf("failed to enable systemd unit file for %s got: %s", u.Name, err)
+				return nil, fmt.Errorf("failed to write %s got: %s", f.Path, err)
+			}
+			if written {
+				changed[u.Name] = true
 			}
+			man.Files = append(man.Files, path)
 		}
+	}
+	for _, u := range units {
 		for _, d := range u.DropIns {
-			spath := dropInPath(mCConfigDir, u, d)
-			dpath := dropInPath(sytemdConfigDir, u, d)
-			if err = writeUnit(spath, d.Contents); err != nil {
-				return fmt.Errorf("failed to write systemd dropin %s got: %s", d.Name, err)
-			}
-			if err = os.MkdirAll(filepath.Dir(dpath), 0755); err != nil {
-				return fmt.Errorf("failed to link systemd dropin %s got: %s", d.Name, err)
+			link := dropInPath(systemdDir, u, d)
+			if err = linkDropIn(dropInPath(mcDir, u, d), link); err != nil {
+				return nil, fmt.Errorf("failed to link systemd dropin %s got: %s", d.Name, err)
 			}
-			if err = os.RemoveAll(dpath); err != nil {
-				return fmt.Errorf("failed to remove symlink target: %s", err)
+			man.Files = append(man.Files, link)
+		}
+	}
+
+	// restarts which failed before are retried, the files of those units
+	// have not changed since
+	pending, err := m.pendingRestarts()
+	if err != nil {
+		return nil, err
+	}
+	for name := range pending {
+		changed[name] = true
+	}
+	pending = make(map[string]bool)
+	for name := range changed {
+		if configured[name] {
+			pending[name] = true
+		}
+	}
+	man.Pending = sortedNames(pending)
+
+	if err = removeStaleSymlinks(systemdDir); err != nil {
+		return nil, fmt.Errorf("failed to remove stale symlinks in: %s got: %s", sytemdConfigDir, err)
+	}
+
+	for _, u := range units {
+		if len(u.Contents) == 0 {
+			continue
+		}
+		if err = m.Systemd.EnableUnitFiles([]string{unitPath(mcDir, u)}); err != nil {
+			return nil, fmt.Errorf("failed to enable systemd unit file for %s got: %s", u.Name, err)
+		}
+		man.Enabled = append(man.Enabled, unitPath(mcDir, u))
+	}
+
+	for _, u := range ordered {
+		man.Units = append(man.Units, u.Name)
+	}
+	for _, path := range m.Paths {
+		man.Paths = append(man.Paths, filepath.Join(m.Root, path))
+	}
+	sort.Strings(man.Files)
+	if err = m.writeManifest(man); err != nil {
+		return nil, fmt.Errorf("failed to write manifest: %s", err)
+	}
+
+	if len(changed) != 0 {
+		if err = m.Systemd.Reload(); err != nil {
+			return nil, fmt.Errorf("failed to reload systemd: %s", err)
+		}
+	}
+
+	summary := &Summary{}
+	for name := range changed {
+		if configured[name] {
+			continue
+		}
+		if err = m.Systemd.StopUnit(name, nil); err != nil {
+			return nil, fmt.Errorf("failed to stop: %s got: %s", name, err)
+		}
+		summary.Stopped = append(summary.Stopped, name)
+	}
+	sort.Strings(summary.Stopped)
+
+	for _, u := range ordered {
+		if changed[u.Name] {
+			if err = m.runJob(ctx, u, m.Systemd.ReloadOrRestartUnit); err != nil {
+				return nil, fmt.Errorf("failed to restart: %s got: %s", u.Name, err)
 			}
-			if err = os.Symlink(spath, dpath); err != nil {
-				return fmt.Errorf("failed to link systemd dropin %s got: %s", d.Name, err)
+			summary.Restarted = append(summary.Restarted, u.Name)
+			delete(pending, u.Name)
+			man.Pending = sortedNames(pending)
+			if err = m.writeManifest(man); err != nil {
+				return nil, fmt.Errorf("failed to write manifest: %s", err)
 			}
+			continue
 		}
+		if err = m.runJob(ctx, u, m.Systemd.StartUnit); err != nil {
+			return nil, fmt.Errorf("failed to start: %s got: %s", u.Name, err)
+		}
+		summary.Started = append(summary.Started, u.Name)
+	}
 
+	return summary, nil
+}
+
+// runJob queues a job for u and waits for its result and for u to become
+// ready, unless u runs in the background.
+func (m Manager) runJob(ctx context.Context, u Unit, job func(string, chan<- string) error) error {
+	if u.Background {
+		return job(u.Name, nil)
+	}
+
+	ch := make(chan string, 1)
+	if err := job(u.Name, ch); err != nil {
+		return err
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case result := <-ch:
+		if result != "done" {
+			return fmt.Errorf("job %s, last journal entries:\n%s", result, m.Systemd.JournalExcerpt(u.Name))
+		}
+	}
+
+	if u.Ready == nil {
+		return nil
+	}
+	if err := waitReady(ctx, m.Root, u.Ready); err != nil {
+		return fmt.Errorf("not ready: %s, last journal entries:\n%s", err, m.Systemd.JournalExcerpt(u.Name))
+	}
+	return nil
+}
+
+func sortedNames(names map[string]bool) []string {
+	var sorted []string
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+// sortUnits orders units such that each unit comes after the units listed
+// in its After, otherwise the given order is kept.
+func sortUnits(units []Unit) ([]Unit, error) {
+	index := make(map[string]int)
+	for i, u := range units {
+		index[u.Name] = i
 	}
 
-	if err = conn.Reload(); err != nil {
-		return fmt.Errorf("failed to reload systemd: %s", err)
+	var ordered []Unit
+	state := make(map[string]int) // 1 visiting, 2 done
+	var visit func(u Unit) error
+	visit = func(u Unit) error {
+		switch state[u.Name] {
+		case 1:
+			return fmt.Errorf("systemd units have a dependency cycle through %s", u.Name)
+		case 2:
+			return nil
+		}
+		state[u.Name] = 1
+		for _, dep := range u.After {
+			// dependencies which are not managed by mc are left to systemd
+			if i, ok := index[dep]; ok {
+				if err := visit(units[i]); err != nil {
+					return err
+				}
+			}
+		}
+		state[u.Name] = 2
+		ordered = append(ordered, u)
+		return nil
 	}
 
 	for _, u := range units {
-		// TODO only reloadOrRestart when config has changed
-		_, err := conn.ReloadOrRestartUnit(u.Name, "replace", nil)
-		if err != nil {
-			return fmt.Errorf("failed to restart: %s got: %s", u.Name, err)
+		if err := visit(u); err != nil {
+			return nil, err
 		}
 	}
+	return ordered, nil
+}
 
+// renderUnit adds the unit file and drop-ins of u to files, keyed by their
+// path in dir.
+func renderUnit(dir string, u Unit, files map[string][]byte) error {
+	if len(u.Contents) != 0 {
+		b, err := ioutil.ReadAll(unit.Serialize(u.Contents))
+		if err != nil {
+			return err
+		}
+		files[unitPath(dir, u)] = b
+	}
+	for _, d := range u.DropIns {
+		b, err := ioutil.ReadAll(unit.Serialize(d.Contents))
+		if err != nil {
+			return err
+		}
+		files[dropInPath(dir, u, d)] = b
+	}
 	return nil
 }
 
-func unitPath(base string, u Unit) string {
-	return path.Join(base, u.Name)
+// unitName returns the name of the unit a file in dir belongs to.
+func unitName(dir, path string) string {
+	rel, _ := filepath.Rel(dir, path)
+	return strings.TrimSuffix(strings.Split(rel, string(filepath.Separator))[0], ".d")
 }
 
-func dropInPath(base string, u Unit, d DropIn) string {
-	return path.Join(base, fmt.Sprintf("%s.d", u.Name), d.Name)
+// removeStaleFiles removes the files in dir which are not desired anymore,
+// and returns the units they belonged to.
+func removeStaleFiles(dir string, desired map[string][]byte) (map[string]bool, error) {
+	units := make(map[string]bool)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		if _, ok := desired[path]; ok {
+			return nil
+		}
+		units[unitName(dir, path)] = true
+		return os.Remove(path)
+	})
+	return units, err
+}
+
+// writeIfChanged atomically replaces the file at path when its content
+// differs from data, and reports whether it did. The mode of an unchanged
+// file is corrected, e.g. for keys written by older mc releases.
+func writeIfChanged(path string, data []byte, mode os.FileMode) (bool, error) {
+	current, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	if err == nil && sha256.Sum256(current) == sha256.Sum256(data) {
+		return false, os.Chmod(path, mode)
+	}
+
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return false, err
+	}
+	tmp := path + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, mode); err != nil {
+		return false, err
+	}
+	return true, os.Rename(tmp, path)
 }
 
-func writeUnit(path string, u []*unit.UnitOption) error {
-	if len(u) == 0 {
+func linkDropIn(source, link string) error {
+	if target, err := os.Readlink(link); err == nil && target == source {
 		return nil
 	}
-	os.MkdirAll(filepath.Dir(path), 0755)
-	b, err := ioutil.ReadAll(unit.Serialize(u))
-	if err != nil {
+	if err := os.MkdirAll(filepath.Dir(link), 0755); err != nil {
 		return err
 	}
+	if err := os.RemoveAll(link); err != nil {
+		return fmt.Errorf("failed to remove symlink target: %s", err)
+	}
+	return os.Symlink(source, link)
+}
 
-	return ioutil.WriteFile(path, b, 0644)
+func unitPath(base string, u Unit) string {
+	return path.Join(base, u.Name)
+}
+
+func dropInPath(base string, u Unit, d DropIn) string {
+	return path.Join(base, fmt.Sprintf("%s.d", u.Name), d.Name)
 }
 
 func removeStaleSymlinks(dir string) error {
 	return filepath.Walk(dir,
 		func(path string, info os.FileInfo, err error) error {
+			if path == dir && os.IsNotExist(err) {
+				return nil
+			}
 			if err != nil {
 				return err
 			}
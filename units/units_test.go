@@ -0,0 +1,449 @@
+package units_test
+
+import (
+	"context"
+	"flag"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/starkandwayne/molten-core/config"
+	"github.com/starkandwayne/molten-core/flannel"
+	. "github.com/starkandwayne/molten-core/units"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// rendered returns the files of a unit in the mc config dir below root,
+// each preceded by its path.
+func rendered(root, name string) string {
+	dir := filepath.Join(root, "etc/mc/system")
+	var paths []string
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		rel, _ := filepath.Rel(dir, path)
+		if err == nil && !info.IsDir() && strings.TrimSuffix(strings.Split(rel, "/")[0], ".d") == name {
+			paths = append(paths, rel)
+		}
+		return nil
+	})
+	sort.Strings(paths)
+
+	var b strings.Builder
+	for _, rel := range paths {
+		data, err := ioutil.ReadFile(filepath.Join(dir, rel))
+		Expect(err).ToNot(HaveOccurred())
+		b.WriteString("# " + rel + "\n")
+		b.Write(data)
+	}
+	return b.String()
+}
+
+func expectGolden(root, name string) {
+	golden := filepath.Join("testdata", name+".golden")
+	out := rendered(root, name)
+	if *update {
+		Expect(ioutil.WriteFile(golden, []byte(out), 0644)).To(Succeed())
+	}
+	expected, err := ioutil.ReadFile(golden)
+	Expect(err).ToNot(HaveOccurred())
+	Expect(out).To(Equal(string(expected)))
+}
+
+var _ = Describe("Manager", func() {
+	var (
+		root  string
+		sock  net.Listener
+		sd    *FakeSystemd
+		m     Manager
+		units []Unit
+		ctx   context.Context
+	)
+
+	BeforeEach(func() {
+		var err error
+		root, err = ioutil.TempDir("", "mc-units")
+		Expect(err).ToNot(HaveOccurred())
+
+		// satisfy the readiness checks of flannel and docker
+		Expect(os.MkdirAll(filepath.Join(root, "run/flannel"), 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(root, "run/flannel/subnet.env"),
+			[]byte("FLANNEL_SUBNET=10.1.1.1/24\nFLANNEL_MTU=1450\n"), 0644)).To(Succeed())
+		sock, err = net.Listen("unix", filepath.Join(root, "run/docker.sock"))
+		Expect(err).ToNot(HaveOccurred())
+		go http.Serve(sock, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("OK"))
+		}))
+
+		sd = &FakeSystemd{}
+		m = Manager{Root: root, Systemd: sd}
+		ctx = context.Background()
+
+		subnet, err := flannel.GetSubnetByIndex(0)
+		Expect(err).ToNot(HaveOccurred())
+		conf := &config.NodeConfig{
+			Subnet:    subnet,
+			PrivateIP: net.ParseIP("10.0.0.5"),
+			Docker:    config.Docker{Endpoint: "10.0.0.5:2376"},
+		}
+		docker, err := Docker(config.DefaultClusterConfig().DockerDaemon, conf.Docker)
+		Expect(err).ToNot(HaveOccurred())
+		units = append([]Unit{
+			docker,
+			DockerTLSSocket(conf.Docker),
+			Flannel(conf),
+			BOSHNetwork,
+		}, BUCC...)
+	})
+
+	AfterEach(func() {
+		sock.Close()
+		os.RemoveAll(root)
+	})
+
+	It("renders the units", func() {
+		_, err := m.Enable(ctx, units)
+		Expect(err).ToNot(HaveOccurred())
+
+		for _, name := range []string{"docker.service", "docker.socket", "flanneld.service",
+			"bucc.service", "bucc-configs.service", "bucc-sync-dns.service", "mc-bosh-network.service"} {
+			expectGolden(root, name)
+		}
+		Expect(sd.Enabled).To(ConsistOf(
+			filepath.Join(root, "etc/mc/system/mc-bosh-network.service"),
+			filepath.Join(root, "etc/mc/system/bucc.service"),
+			filepath.Join(root, "etc/mc/system/bucc-configs.service"),
+			filepath.Join(root, "etc/mc/system/bucc-sync-dns.service"),
+		))
+	})
+
+	It("restarts units in dependency order", func() {
+		summary, err := m.Enable(ctx, units)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(sd.Jobs).To(Equal([]string{
+			"restart flanneld.service",
+			"restart docker.socket",
+			"restart docker.service",
+			"restart mc-bosh-network.service",
+			"restart bucc.service",
+			"restart bucc-configs.service",
+			"restart bucc-sync-dns.service",
+		}))
+		Expect(summary.Restarted).To(HaveLen(7))
+		Expect(sd.Reloads).To(Equal(1))
+	})
+
+	It("only restarts units which have changed", func() {
+		_, err := m.Enable(ctx, units)
+		Expect(err).ToNot(HaveOccurred())
+
+		sd.Jobs = nil
+		subnet, err := flannel.GetSubnetByIndex(0)
+		Expect(err).ToNot(HaveOccurred())
+		units[2] = Flannel(&config.NodeConfig{Subnet: subnet, PrivateIP: net.ParseIP("10.0.0.6")})
+		summary, err := m.Enable(ctx, units)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(summary.Restarted).To(Equal([]string{"flanneld.service"}))
+		Expect(summary.Started).To(HaveLen(6))
+		Expect(sd.Jobs).To(ContainElement("restart flanneld.service"))
+		Expect(sd.Jobs).To(ContainElement("start docker.service"))
+		Expect(sd.Reloads).To(Equal(2))
+	})
+
+	It("does not reload systemd when nothing has changed", func() {
+		_, err := m.Enable(ctx, units)
+		Expect(err).ToNot(HaveOccurred())
+		summary, err := m.Enable(ctx, units)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(summary.Restarted).To(BeEmpty())
+		Expect(sd.Reloads).To(Equal(1))
+	})
+
+	It("stops units which are no longer configured and removes their links", func() {
+		_, err := m.Enable(ctx, units)
+		Expect(err).ToNot(HaveOccurred())
+		link := filepath.Join(root, "etc/systemd/system/docker.service.d/30-enable-mtls.conf")
+		Expect(link).To(BeAnExistingFile())
+
+		// a symlink not managed by mc, which is not stale
+		other := filepath.Join(root, "etc/systemd/system/other.service")
+		Expect(os.Symlink(filepath.Join(root, "run/flannel/subnet.env"), other)).To(Succeed())
+
+		summary, err := m.Enable(ctx, []Unit{units[2]})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(summary.Stopped).To(ConsistOf("docker.service", "docker.socket", "bucc.service",
+			"bucc-configs.service", "bucc-sync-dns.service", "mc-bosh-network.service"))
+		Expect(summary.Started).To(Equal([]string{"flanneld.service"}))
+
+		_, err = os.Lstat(link)
+		Expect(os.IsNotExist(err)).To(BeTrue())
+		Expect(filepath.Join(root, "etc/mc/system/bucc.service")).ToNot(BeAnExistingFile())
+		Expect(other).To(BeAnExistingFile())
+	})
+
+	It("reports failed jobs with the journal of the unit", func() {
+		sd.Results = map[string]string{"docker.service": "failed"}
+		sd.Journal = map[string]string{"docker.service": "dockerd: invalid bip"}
+		_, err := m.Enable(ctx, units)
+		Expect(err).To(MatchError(ContainSubstring("failed to restart: docker.service got: job failed")))
+		Expect(err).To(MatchError(ContainSubstring("dockerd: invalid bip")))
+		Expect(sd.Jobs).ToNot(ContainElement("restart bucc.service"))
+	})
+
+	It("retries restarts which failed before", func() {
+		sd.Results = map[string]string{"docker.service": "failed"}
+		_, err := m.Enable(ctx, units)
+		Expect(err).To(HaveOccurred())
+
+		man, err := m.LoadManifest()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(man.Pending).To(ConsistOf("docker.service", "mc-bosh-network.service", "bucc.service",
+			"bucc-configs.service", "bucc-sync-dns.service"))
+
+		sd.Results, sd.Jobs = nil, nil
+		summary, err := m.Enable(ctx, units)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(summary.Restarted).To(Equal([]string{"docker.service", "mc-bosh-network.service",
+			"bucc.service", "bucc-configs.service", "bucc-sync-dns.service"}))
+		Expect(sd.Jobs).To(ContainElement("start flanneld.service"))
+
+		man, err = m.LoadManifest()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(man.Pending).To(BeEmpty())
+	})
+
+	It("records what it has created in a manifest", func() {
+		m.Paths = []string{"/var/ssl/docker"}
+		_, err := m.Enable(ctx, units)
+		Expect(err).ToNot(HaveOccurred())
+
+		man, err := m.LoadManifest()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(man.Units).To(HaveLen(7))
+		Expect(man.Enabled).To(HaveLen(4))
+		Expect(man.Files).To(ContainElement(filepath.Join(root, "etc/systemd/system/docker.service.d/30-enable-mtls.conf")))
+		Expect(man.Files).To(ContainElement(filepath.Join(root, "etc/mc/system/bucc.service")))
+		Expect(man.Paths).To(Equal([]string{filepath.Join(root, "var/ssl/docker")}))
+	})
+
+	It("uninstalls everything in the manifest", func() {
+		certs := filepath.Join(root, "var/ssl/docker")
+		Expect(os.MkdirAll(certs, 0755)).To(Succeed())
+		m.Paths = []string{"/var/ssl/docker"}
+		_, err := m.Enable(ctx, units)
+		Expect(err).ToNot(HaveOccurred())
+
+		sd.Jobs = nil
+		summary, err := m.Uninstall(ctx)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(summary.Stopped).To(Equal([]string{"bucc-sync-dns.service",
+			"bucc-configs.service", "bucc.service", "mc-bosh-network.service"}))
+		Expect(summary.Restarted).To(Equal([]string{"flanneld.service", "docker.socket", "docker.service"}))
+		Expect(sd.Disabled).To(ConsistOf("bucc.service", "bucc-configs.service",
+			"bucc-sync-dns.service", "mc-bosh-network.service"))
+		Expect(sd.Jobs).To(ContainElement("try-restart docker.service"))
+
+		Expect(certs).ToNot(BeADirectory())
+		Expect(filepath.Join(root, "etc/mc/system")).ToNot(BeADirectory())
+		Expect(filepath.Join(root, "etc/systemd/system/docker.service.d")).ToNot(BeADirectory())
+
+		_, err = m.LoadManifest()
+		Expect(err).To(MatchError(ContainSubstring("has mc init run on this node?")))
+	})
+
+	It("restarts the proxy when its config or certificates change", func() {
+		units = append(units, Proxy("caddy", []File{
+			{Path: "/var/lib/moltencore/proxy/key.pem", Contents: []byte("key"), Mode: 0600},
+			ProxyConfig("example.com {}"),
+		}))
+		_, err := m.Enable(ctx, units)
+		Expect(err).ToNot(HaveOccurred())
+		info, err := os.Stat(filepath.Join(root, "var/lib/moltencore/proxy/key.pem"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+
+		units[len(units)-1] = Proxy("caddy", []File{
+			{Path: "/var/lib/moltencore/proxy/key.pem", Contents: []byte("key"), Mode: 0600},
+			ProxyConfig("example.org {}"),
+		})
+		summary, err := m.Enable(ctx, units)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(summary.Restarted).To(Equal([]string{"mc-proxy.service"}))
+	})
+
+	It("stops and disables the agent", func() {
+		Expect(m.DisableAgent(ctx)).To(Succeed())
+		Expect(sd.Disabled).To(Equal([]string{"mc.service"}))
+		Expect(sd.Jobs).To(Equal([]string{"stop mc.service"}))
+
+		sd.Results = map[string]string{"mc.service": "failed"}
+		Expect(m.DisableAgent(ctx)).To(MatchError(ContainSubstring("job failed")))
+	})
+
+	It("writes the docker daemon config and restarts docker when it changes", func() {
+		_, err := m.Enable(ctx, units)
+		Expect(err).ToNot(HaveOccurred())
+		daemonJSON, err := ioutil.ReadFile(filepath.Join(root, "etc/docker/daemon.json"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(daemonJSON).To(MatchJSON(`{"log-driver":"json-file","log-opts":{"max-size":"50m","max-file":"3"}}`))
+
+		d := config.DefaultClusterConfig().DockerDaemon
+		d.DataRoot = "/mnt/docker"
+		units[0], err = Docker(d, config.Docker{})
+		Expect(err).ToNot(HaveOccurred())
+		summary, err := m.Enable(ctx, units)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(summary.Restarted).To(Equal([]string{"docker.service"}))
+	})
+
+	It("writes the docker TLS certs and restarts docker when they change", func() {
+		_, err := m.Enable(ctx, units)
+		Expect(err).ToNot(HaveOccurred())
+
+		tls := config.Docker{Endpoint: "10.0.0.5:2376"}
+		tls.CA.Cert = []byte("ca")
+		tls.Server.Cert = []byte("cert")
+		tls.Server.Key = []byte("key")
+		units[0], err = Docker(config.DefaultClusterConfig().DockerDaemon, tls)
+		Expect(err).ToNot(HaveOccurred())
+		summary, err := m.Enable(ctx, units)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(summary.Restarted).To(Equal([]string{"docker.service"}))
+		key, err := ioutil.ReadFile(filepath.Join(root, "var/ssl/docker/key.pem"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(key)).To(Equal("key"))
+		info, err := os.Stat(filepath.Join(root, "var/ssl/docker/key.pem"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+	})
+
+	It("rejects a docker bridge overlapping the flannel network", func() {
+		d := config.DefaultClusterConfig().DockerDaemon
+		d.BridgeIP = "10.1.255.1/24"
+		_, err := Docker(d, config.Docker{})
+		Expect(err).To(MatchError(ContainSubstring("overlaps the flannel network")))
+
+		d.BridgeIP = "10.0.0.1/8"
+		_, err = Docker(d, config.Docker{})
+		Expect(err).To(MatchError(ContainSubstring("overlaps the flannel network")))
+	})
+
+	It("rejects dependency cycles", func() {
+		_, err := m.Enable(ctx, []Unit{
+			{Name: "a.service", After: []string{"b.service"}},
+			{Name: "b.service", After: []string{"a.service"}},
+		})
+		Expect(err).To(MatchError(ContainSubstring("dependency cycle")))
+	})
+})
+
+var _ = Describe("Render", func() {
+	It("renders the same files Enable writes", func() {
+		conf, err := config.SampleNodeConfig(0, net.ParseIP("10.0.0.5"))
+		Expect(err).ToNot(HaveOccurred())
+		u, err := NodeUnits(conf, config.DefaultClusterConfig(), false, nil)
+		Expect(err).ToNot(HaveOccurred())
+		files, err := Render(u)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(files).To(HaveKey("bucc.service"))
+
+		expected, err := ioutil.ReadFile(filepath.Join("testdata", "docker.socket.golden"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect("# docker.socket.d/30-listen-stream.conf\n" +
+			string(files["docker.socket.d/30-listen-stream.conf"])).To(Equal(string(expected)))
+	})
+
+	It("only renders the BUCC units for zone 0", func() {
+		conf, err := config.SampleNodeConfig(1, net.ParseIP("10.0.0.6"))
+		Expect(err).ToNot(HaveOccurred())
+		u, err := NodeUnits(conf, config.DefaultClusterConfig(), false, nil)
+		Expect(err).ToNot(HaveOccurred())
+		files, err := Render(u)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(files).ToNot(HaveKey("bucc.service"))
+		Expect(files).To(HaveKey("flanneld.service.d/30-mc-flannel.conf"))
+	})
+
+	It("renders the config files read by the units", func() {
+		conf, err := config.SampleNodeConfig(0, net.ParseIP("10.0.0.5"))
+		Expect(err).ToNot(HaveOccurred())
+		cc := config.DefaultClusterConfig()
+		cc.Proxy.Domain = "mc.example.com"
+		u, err := NodeUnits(conf, cc, true, []File{
+			ProxyConfig("mc.example.com {}"),
+			{Path: "/var/lib/moltencore/proxy/key.pem", Contents: []byte("key"), Mode: 0600},
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		var paths []string
+		for _, f := range RenderFiles(u) {
+			paths = append(paths, f.Path)
+			Expect(f.Secret()).To(Equal(filepath.Base(f.Path) == "key.pem"))
+		}
+		Expect(paths).To(Equal([]string{
+			"/etc/docker/daemon.json",
+			"/var/lib/moltencore/proxy/Caddyfile",
+			"/var/lib/moltencore/proxy/key.pem",
+			"/var/ssl/docker/ca.pem",
+			"/var/ssl/docker/cert.pem",
+			"/var/ssl/docker/key.pem",
+		}))
+	})
+
+	It("leaves deploying BUCC to the agent", func() {
+		conf, err := config.SampleNodeConfig(0, net.ParseIP("10.0.0.5"))
+		Expect(err).ToNot(HaveOccurred())
+		u, err := NodeUnits(conf, config.DefaultClusterConfig(), true, nil)
+		Expect(err).ToNot(HaveOccurred())
+		files, err := Render(u)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(files).ToNot(HaveKey("bucc.service"))
+		Expect(files).ToNot(HaveKey("bucc-configs.service"))
+		Expect(files).To(HaveKey("bucc-sync-dns.service"))
+	})
+})
+
+var _ = Describe("ReadyCheck", func() {
+	var root string
+
+	BeforeEach(func() {
+		var err error
+		root, err = ioutil.TempDir("", "mc-ready")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(root)
+	})
+
+	It("is not ready while the subnet env holds the subnet of an earlier run", func() {
+		path := filepath.Join(root, "subnet.env")
+		Expect(ioutil.WriteFile(path, []byte("FLANNEL_SUBNET=10.1.2.1/24\n"), 0644)).To(Succeed())
+		Expect(SubnetEnvMatches("subnet.env", "10.1.1.0/24")(root)).To(MatchError(ContainSubstring("instead of 10.1.1.0/24")))
+
+		Expect(ioutil.WriteFile(path, []byte("FLANNEL_SUBNET=10.1.1.1/24\n"), 0644)).To(Succeed())
+		Expect(SubnetEnvMatches("subnet.env", "10.1.1.0/24")(root)).To(Succeed())
+	})
+
+	It("is not ready while only the docker socket accepts connections", func() {
+		sock, err := net.Listen("unix", filepath.Join(root, "docker.sock"))
+		Expect(err).ToNot(HaveOccurred())
+		defer sock.Close()
+		go func() {
+			for {
+				c, err := sock.Accept()
+				if err != nil {
+					return
+				}
+				c.Close()
+			}
+		}()
+		Expect(DockerPings("docker.sock")(root)).ToNot(Succeed())
+	})
+})
@@ -0,0 +1,39 @@
+package util
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+const (
+	meminfoFile = "/proc/meminfo"
+)
+
+func LookupCapacity() (int, int, error) {
+	f, err := os.Open(meminfoFile)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "MemTotal:" {
+			continue
+		}
+		kb, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to parse MemTotal: %s", err)
+		}
+		return runtime.NumCPU(), kb / 1024, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, 0, err
+	}
+	return 0, 0, fmt.Errorf("MemTotal not found in %s", meminfoFile)
+}
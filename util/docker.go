@@ -0,0 +1,190 @@
+package util
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/sirupsen/logrus"
+)
+
+// NewDockerClient connects to the docker daemon of this node, waiting for
+// it to become available.
+func NewDockerClient(ctx context.Context) (*client.Client, error) {
+	return connectDocker(ctx, func(ping func() error) error {
+		return RetryDocker(ctx, "docker daemon", ping)
+	})
+}
+
+// DialDocker connects to the docker daemon of this node, it fails right away
+// when docker is not available, e.g. for probes.
+func DialDocker(ctx context.Context) (*client.Client, error) {
+	return connectDocker(ctx, func(ping func() error) error {
+		return ping()
+	})
+}
+
+func connectDocker(ctx context.Context, wait func(ping func() error) error) (*client.Client, error) {
+	cli, err := client.NewClientWithOpts(client.FromEnv)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create docker client: %s", err)
+	}
+	err = wait(func() error {
+		_, err := cli.Ping(ctx)
+		return err
+	})
+	if err != nil {
+		cli.Close()
+		return nil, fmt.Errorf("failed to connect to docker: %s", err)
+	}
+	cli.NegotiateAPIVersion(ctx)
+	return cli, nil
+}
+
+// RemoveNetwork removes the network name, together with the containers
+// attached to it.
+func RemoveNetwork(ctx context.Context, cli *client.Client, logger *logrus.Entry, name string) error {
+	res, err := cli.NetworkInspect(ctx, name, types.NetworkInspectOptions{})
+	if client.IsErrNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to inspect network %s: %s", name, err)
+	}
+
+	for id, c := range res.Containers {
+		logger.Infof("Removing container %s from network %s", c.Name, name)
+		err = cli.ContainerRemove(ctx, id, types.ContainerRemoveOptions{Force: true, RemoveVolumes: true})
+		if err != nil && !client.IsErrNotFound(err) {
+			return fmt.Errorf("failed to remove container %s: %s", c.Name, err)
+		}
+	}
+
+	if err = cli.NetworkRemove(ctx, name); err != nil && !client.IsErrNotFound(err) {
+		return fmt.Errorf("failed to remove network %s: %s", name, err)
+	}
+	return nil
+}
+
+type PullAuth struct {
+	ServerAddress string
+	Username      string
+	Password      string
+}
+
+// PullImage pulls ref, authenticating against the registry when credentials
+// are given, and logs the progress of each layer.
+func PullImage(ctx context.Context, cli *client.Client, logger *logrus.Entry, ref string, auth PullAuth) error {
+	opts := types.ImagePullOptions{}
+	if auth.Username != "" {
+		raw, err := json.Marshal(types.AuthConfig{
+			Username:      auth.Username,
+			Password:      auth.Password,
+			ServerAddress: auth.ServerAddress,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to encode registry auth: %s", err)
+		}
+		opts.RegistryAuth = base64.URLEncoding.EncodeToString(raw)
+	}
+
+	var reader io.ReadCloser
+	err := RetryDocker(ctx, "docker to pull "+ref, func() (err error) {
+		reader, err = cli.ImagePull(ctx, ref, opts)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to pull image %s: %s", ref, err)
+	}
+	defer reader.Close()
+
+	return logPullProgress(logger, ref, reader)
+}
+
+// LoadImage loads the image archive r and tags the image it contains as ref,
+// docker load does not record the digest the image has been pushed with.
+func LoadImage(ctx context.Context, cli *client.Client, r io.Reader, ref string) error {
+	resp, err := cli.ImageLoad(ctx, r, true)
+	if err != nil {
+		return fmt.Errorf("failed to load image archive: %s", err)
+	}
+	defer resp.Body.Close()
+
+	loaded, err := loadedImage(resp.Body)
+	if err != nil {
+		return err
+	}
+	if err = cli.ImageTag(ctx, loaded, ref); err != nil {
+		return fmt.Errorf("failed to tag image %s as %s: %s", loaded, ref, err)
+	}
+	return nil
+}
+
+// loadedImage returns the first image docker load reports, by tag or by id
+// for archives without tags.
+func loadedImage(r io.Reader) (string, error) {
+	dec := json.NewDecoder(r)
+	for {
+		var msg jsonmessage.JSONMessage
+		if err := dec.Decode(&msg); err == io.EOF {
+			return "", fmt.Errorf("image archive does not contain an image")
+		} else if err != nil {
+			return "", fmt.Errorf("failed to read image load output: %s", err)
+		}
+		if msg.Error != nil {
+			return "", fmt.Errorf("failed to load image archive: %s", msg.Error.Message)
+		}
+		for _, prefix := range []string{"Loaded image ID: ", "Loaded image: "} {
+			if strings.HasPrefix(msg.Stream, prefix) {
+				return strings.TrimSpace(strings.TrimPrefix(msg.Stream, prefix)), nil
+			}
+		}
+	}
+}
+
+// logPullProgress logs every status change of the pulled layers, while
+// skipping the download and extract progress updates in between.
+func logPullProgress(logger *logrus.Entry, ref string, r io.Reader) error {
+	status := make(map[string]string)
+	dec := json.NewDecoder(r)
+	for {
+		var msg jsonmessage.JSONMessage
+		if err := dec.Decode(&msg); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to read pull progress for %s: %s", ref, err)
+		}
+		if msg.Error != nil {
+			return fmt.Errorf("failed to pull image %s: %s", ref, msg.Error.Message)
+		}
+		if status[msg.ID] == msg.Status {
+			continue
+		}
+		status[msg.ID] = msg.Status
+		if msg.ID == "" {
+			logger.Infof("Pulling %s: %s", ref, msg.Status)
+		} else {
+			logger.WithField("layer", msg.ID).Debugf("Pulling %s: %s", ref, msg.Status)
+		}
+	}
+}
+
+// RetryDocker retries op while the docker daemon is unavailable or fails,
+// errors caused by the request itself (e.g. unknown images) are returned.
+func RetryDocker(ctx context.Context, what string, op func() error) error {
+	return Retry(ctx, what, func() error {
+		err := op()
+		if errdefs.IsNotFound(err) || errdefs.IsUnauthorized(err) ||
+			errdefs.IsForbidden(err) || errdefs.IsInvalidParameter(err) {
+			return Permanent(err)
+		}
+		return err
+	})
+}
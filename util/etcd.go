@@ -1,6 +1,7 @@
 package util
 
 import (
+	"context"
 	"fmt"
 	"time"
 
@@ -9,6 +10,16 @@ import (
 )
 
 func NewEtcdV2KeysAPI() (client.KeysAPI, error) {
+	c, err := newEtcdV2Client()
+	if err != nil {
+		return nil, err
+	}
+	return retryKeysAPI{client.NewKeysAPI(c)}, nil
+}
+
+// NewEtcdV2ProbeKeysAPI does not retry requests, so probes report etcd as
+// unavailable instead of waiting for it.
+func NewEtcdV2ProbeKeysAPI() (client.KeysAPI, error) {
 	c, err := newEtcdV2Client()
 	if err != nil {
 		return nil, err
@@ -16,6 +27,55 @@ func NewEtcdV2KeysAPI() (client.KeysAPI, error) {
 	return client.NewKeysAPI(c), nil
 }
 
+// retryKeysAPI retries requests while etcd is unavailable, e.g. when it has
+// no quorum yet during cluster bootstrap.
+type retryKeysAPI struct {
+	client.KeysAPI
+}
+
+func (k retryKeysAPI) Get(ctx context.Context, key string, opts *client.GetOptions) (resp *client.Response, err error) {
+	err = retryEtcd(ctx, key, func() error {
+		resp, err = k.KeysAPI.Get(ctx, key, opts)
+		return err
+	})
+	return resp, err
+}
+
+func (k retryKeysAPI) Set(ctx context.Context, key, value string, opts *client.SetOptions) (resp *client.Response, err error) {
+	err = retryEtcd(ctx, key, func() error {
+		resp, err = k.KeysAPI.Set(ctx, key, value, opts)
+		return err
+	})
+	return resp, err
+}
+
+func (k retryKeysAPI) Delete(ctx context.Context, key string, opts *client.DeleteOptions) (resp *client.Response, err error) {
+	err = retryEtcd(ctx, key, func() error {
+		resp, err = k.KeysAPI.Delete(ctx, key, opts)
+		return err
+	})
+	return resp, err
+}
+
+func retryEtcd(ctx context.Context, key string, op func() error) error {
+	return Retry(ctx, fmt.Sprintf("etcd (%s)", key), func() error {
+		err := op()
+		if err != nil && !isRetryableEtcdError(err) {
+			return Permanent(err)
+		}
+		return err
+	})
+}
+
+// isRetryableEtcdError reports whether err is caused by etcd being
+// unavailable, rather than etcd answering the request with an error.
+func isRetryableEtcdError(err error) bool {
+	if e, ok := err.(client.Error); ok {
+		return e.Code == client.ErrorCodeRaftInternal || e.Code == client.ErrorCodeLeaderElect
+	}
+	return true
+}
+
 func NewEtcdV2MembersAPI() (client.MembersAPI, error) {
 	c, err := newEtcdV2Client()
 	if err != nil {
@@ -24,6 +84,24 @@ func NewEtcdV2MembersAPI() (client.MembersAPI, error) {
 	return client.NewMembersAPI(c), nil
 }
 
+// EtcdStatus returns the number of members of the etcd cluster, and whether
+// it has elected a leader.
+func EtcdStatus(ctx context.Context) (int, bool, error) {
+	mapi, err := NewEtcdV2MembersAPI()
+	if err != nil {
+		return 0, false, err
+	}
+	members, err := mapi.List(ctx)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to list etcd members: %s", err)
+	}
+	leader, err := mapi.Leader(ctx)
+	if err != nil {
+		return len(members), false, nil
+	}
+	return len(members), leader != nil, nil
+}
+
 func newEtcdV2Client() (client.Client, error) {
 	cfg := client.Config{
 		Endpoints:               []string{"http://127.0.0.1:2379"},
@@ -0,0 +1,27 @@
+package util
+
+import (
+	"context"
+	"io/ioutil"
+
+	"github.com/sirupsen/logrus"
+)
+
+type loggerKey struct{}
+
+// WithLogger returns a copy of ctx carrying l, for packages which are not
+// handed a logger of their own (e.g. config).
+func WithLogger(ctx context.Context, l *logrus.Entry) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// Logger returns the logger carried by ctx, which discards everything
+// when there is none.
+func Logger(ctx context.Context) *logrus.Entry {
+	if l, ok := ctx.Value(loggerKey{}).(*logrus.Entry); ok {
+		return l
+	}
+	discard := logrus.New()
+	discard.SetOutput(ioutil.Discard)
+	return logrus.NewEntry(discard)
+}
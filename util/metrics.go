@@ -0,0 +1,71 @@
+package util
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// Metrics collects samples and writes them in the Prometheus text
+// exposition format.
+type Metrics struct {
+	families []*metricFamily
+}
+
+type metricFamily struct {
+	name    string
+	help    string
+	kind    string
+	samples []string
+}
+
+// Gauge adds a sample of the gauge name, labels are given as key value pairs.
+func (m *Metrics) Gauge(name, help string, value float64, labels ...string) {
+	m.add(name, help, "gauge", value, labels)
+}
+
+// Counter adds a sample of the counter name, labels are given as key value
+// pairs.
+func (m *Metrics) Counter(name, help string, value float64, labels ...string) {
+	m.add(name, help, "counter", value, labels)
+}
+
+func (m *Metrics) add(name, help, kind string, value float64, labels []string) {
+	var f *metricFamily
+	for _, family := range m.families {
+		if family.name == name {
+			f = family
+		}
+	}
+	if f == nil {
+		f = &metricFamily{name: name, help: help, kind: kind}
+		m.families = append(m.families, f)
+	}
+
+	var pairs []string
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, labels[i], labelEscaper.Replace(labels[i+1])))
+	}
+	sample := name
+	if len(pairs) != 0 {
+		sample += "{" + strings.Join(pairs, ",") + "}"
+	}
+	f.samples = append(f.samples, sample+" "+strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+// WriteTo writes all samples grouped by metric, in the order they were added.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	var b strings.Builder
+	for _, f := range m.families {
+		fmt.Fprintf(&b, "# HELP %s %s\n", f.name, f.help)
+		fmt.Fprintf(&b, "# TYPE %s %s\n", f.name, f.kind)
+		for _, s := range f.samples {
+			b.WriteString(s + "\n")
+		}
+	}
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
@@ -0,0 +1,41 @@
+package util_test
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/starkandwayne/molten-core/util"
+)
+
+var _ = Describe("Metrics", func() {
+	It("writes samples grouped by metric", func() {
+		var m Metrics
+		m.Gauge("mc_up", "Whether mc is up", 1, "zone", "z0")
+		m.Counter("mc_restarts_total", "Restarts", 3)
+		m.Gauge("mc_up", "Whether mc is up", 0, "zone", "z1")
+
+		var b strings.Builder
+		_, err := m.WriteTo(&b)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(b.String()).To(Equal(`# HELP mc_up Whether mc is up
+# TYPE mc_up gauge
+mc_up{zone="z0"} 1
+mc_up{zone="z1"} 0
+# HELP mc_restarts_total Restarts
+# TYPE mc_restarts_total counter
+mc_restarts_total 3
+`))
+	})
+
+	It("escapes label values", func() {
+		var m Metrics
+		m.Gauge("mc_info", "Info", 1, "name", "a\"b\\c\nd")
+
+		var b strings.Builder
+		_, err := m.WriteTo(&b)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(b.String()).To(ContainSubstring(`mc_info{name="a\"b\\c\nd"} 1`))
+	})
+})
@@ -0,0 +1,105 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	bridgeMTUOption = "com.docker.network.driver.mtu"
+)
+
+// NetworkSpec is the desired state of a bridge network.
+type NetworkSpec struct {
+	Name       string
+	Subnet     string
+	Gateway    string
+	MTU        int
+	Attachable bool
+}
+
+// Diff returns how the network n differs from the spec, nil when it matches.
+func (s NetworkSpec) Diff(n types.NetworkResource) []string {
+	var diff []string
+	if n.Driver != "bridge" {
+		diff = append(diff, fmt.Sprintf("driver %s instead of bridge", n.Driver))
+	}
+	if len(n.IPAM.Config) != 1 {
+		diff = append(diff, fmt.Sprintf("%d subnets instead of %s", len(n.IPAM.Config), s.Subnet))
+	} else {
+		if c := n.IPAM.Config[0]; c.Subnet != s.Subnet {
+			diff = append(diff, fmt.Sprintf("subnet %s instead of %s", c.Subnet, s.Subnet))
+		} else if c.Gateway != s.Gateway {
+			diff = append(diff, fmt.Sprintf("gateway %s instead of %s", c.Gateway, s.Gateway))
+		}
+	}
+	if mtu := n.Options[bridgeMTUOption]; mtu != strconv.Itoa(s.MTU) {
+		diff = append(diff, fmt.Sprintf("mtu %q instead of %d", mtu, s.MTU))
+	}
+	if n.Attachable != s.Attachable {
+		diff = append(diff, fmt.Sprintf("attachable %t instead of %t", n.Attachable, s.Attachable))
+	}
+	return diff
+}
+
+// ReconcileNetwork creates the network described by spec, an existing
+// network which differs is recreated once the containers attached to it
+// have been stopped (waiting up to drainTimeout for each) and disconnected.
+// It reports whether the network has been (re)created.
+func ReconcileNetwork(ctx context.Context, cli *client.Client, logger *logrus.Entry, spec NetworkSpec, drainTimeout time.Duration) (bool, error) {
+	n, err := cli.NetworkInspect(ctx, spec.Name, types.NetworkInspectOptions{})
+	if err != nil && !client.IsErrNotFound(err) {
+		return false, fmt.Errorf("failed to inspect network %s: %s", spec.Name, err)
+	}
+
+	if err == nil {
+		diff := spec.Diff(n)
+		if diff == nil {
+			return false, nil
+		}
+		logger.Warnf("Recreating network %s, it has %v", spec.Name, diff)
+		if err = drainNetwork(ctx, cli, logger, n, drainTimeout); err != nil {
+			return false, err
+		}
+		if err = cli.NetworkRemove(ctx, n.ID); err != nil {
+			return false, fmt.Errorf("failed to remove network %s: %s", spec.Name, err)
+		}
+	}
+
+	logger.Infof("Creating network %s with subnet %s", spec.Name, spec.Subnet)
+	_, err = cli.NetworkCreate(ctx, spec.Name, types.NetworkCreate{
+		CheckDuplicate: true,
+		Driver:         "bridge",
+		Attachable:     spec.Attachable,
+		IPAM: &network.IPAM{Config: []network.IPAMConfig{
+			{Subnet: spec.Subnet, Gateway: spec.Gateway},
+		}},
+		Options: map[string]string{bridgeMTUOption: strconv.Itoa(spec.MTU)},
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to create network %s: %s", spec.Name, err)
+	}
+	return true, nil
+}
+
+// drainNetwork stops the containers attached to n and disconnects them,
+// their addresses are not valid in the recreated network.
+func drainNetwork(ctx context.Context, cli *client.Client, logger *logrus.Entry, n types.NetworkResource, timeout time.Duration) error {
+	for id, c := range n.Containers {
+		logger.Warnf("Stopping container %s (%s) attached to network %s", c.Name, c.IPv4Address, n.Name)
+		if err := cli.ContainerStop(ctx, id, &timeout); err != nil && !client.IsErrNotFound(err) {
+			return fmt.Errorf("failed to stop container %s: %s", c.Name, err)
+		}
+		if err := cli.NetworkDisconnect(ctx, n.ID, id, true); err != nil && !client.IsErrNotFound(err) {
+			return fmt.Errorf("failed to disconnect container %s: %s", c.Name, err)
+		}
+	}
+	return nil
+}
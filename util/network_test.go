@@ -0,0 +1,44 @@
+package util_test
+
+import (
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/network"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/starkandwayne/molten-core/util"
+)
+
+var _ = Describe("NetworkSpec", func() {
+	var (
+		spec NetworkSpec
+		n    types.NetworkResource
+	)
+
+	BeforeEach(func() {
+		spec = NetworkSpec{Name: "bosh", Subnet: "10.1.1.0/24", Gateway: "10.1.1.1", MTU: 1450, Attachable: true}
+		n = types.NetworkResource{
+			Name:       "bosh",
+			Driver:     "bridge",
+			Attachable: true,
+			IPAM:       network.IPAM{Config: []network.IPAMConfig{{Subnet: "10.1.1.0/24", Gateway: "10.1.1.1"}}},
+			Options:    map[string]string{"com.docker.network.driver.mtu": "1450"},
+		}
+	})
+
+	It("matches a network created from the spec", func() {
+		Expect(spec.Diff(n)).To(BeNil())
+	})
+
+	It("detects a stale subnet", func() {
+		n.IPAM.Config[0].Subnet = "10.1.2.0/24"
+		Expect(spec.Diff(n)).To(Equal([]string{"subnet 10.1.2.0/24 instead of 10.1.1.0/24"}))
+	})
+
+	It("detects a different mtu and a network which is not attachable", func() {
+		n.Options = nil
+		n.Attachable = false
+		Expect(spec.Diff(n)).To(Equal([]string{`mtu "" instead of 1450`, "attachable false instead of true"}))
+	})
+})
@@ -0,0 +1,56 @@
+package util
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"strings"
+)
+
+// systemd-resolved points /etc/resolv.conf at its local stub listener, the
+// upstream name servers are only listed in the resolved copy.
+var (
+	resolvConfFiles []string = []string{
+		"/run/systemd/resolve/resolv.conf",
+		"/etc/resolv.conf",
+	}
+)
+
+func LookupDNSRecursors() ([]string, error) {
+	for _, path := range resolvConfFiles {
+		recursors, err := nameservers(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(recursors) != 0 {
+			return recursors, nil
+		}
+	}
+	return nil, nil
+}
+
+func nameservers(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var out []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "nameserver" {
+			continue
+		}
+		ip := net.ParseIP(fields[1])
+		if ip == nil || ip.IsLoopback() {
+			continue
+		}
+		out = append(out, ip.String())
+	}
+	return out, scanner.Err()
+}
@@ -0,0 +1,77 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Backoff is a retry policy with exponentially growing intervals.
+type Backoff struct {
+	Initial    time.Duration
+	Max        time.Duration
+	Multiplier float64
+	// MaxElapsed bounds the total time spent retrying, 0 retries until
+	// the context is done.
+	MaxElapsed time.Duration
+}
+
+// DefaultBackoff covers the time etcd and docker need to come up during boot.
+var DefaultBackoff = Backoff{
+	Initial:    500 * time.Millisecond,
+	Max:        15 * time.Second,
+	Multiplier: 2,
+	MaxElapsed: 5 * time.Minute,
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+// Permanent marks err as not worth retrying.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// Retry calls op until it succeeds, fails permanently, the policy gives up or
+// ctx is done. Failed attempts are logged as waiting on what.
+func (b Backoff) Retry(ctx context.Context, what string, op func() error) error {
+	start := time.Now()
+	interval := b.Initial
+	for attempt := 1; ; attempt++ {
+		err := op()
+		if err == nil {
+			return nil
+		}
+		if p, ok := err.(*permanentError); ok {
+			return p.err
+		}
+		if b.MaxElapsed > 0 && time.Since(start)+interval > b.MaxElapsed {
+			return fmt.Errorf("gave up waiting for %s after %d attempts: %s", what, attempt, err)
+		}
+
+		Logger(ctx).Infof("Waiting for %s, retrying in %s: %s", what, interval, err)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("gave up waiting for %s: %s (last error: %s)", what, ctx.Err(), err)
+		case <-time.After(interval):
+		}
+
+		interval = time.Duration(float64(interval) * b.Multiplier)
+		if b.Max > 0 && interval > b.Max {
+			interval = b.Max
+		}
+	}
+}
+
+// Retry calls op with the DefaultBackoff policy.
+func Retry(ctx context.Context, what string, op func() error) error {
+	return DefaultBackoff.Retry(ctx, what, op)
+}
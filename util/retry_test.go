@@ -0,0 +1,66 @@
+package util_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/starkandwayne/molten-core/util"
+)
+
+var _ = Describe("Backoff", func() {
+	var (
+		b        Backoff
+		attempts int
+		ctx      context.Context
+	)
+
+	BeforeEach(func() {
+		b = Backoff{Initial: time.Millisecond, Max: 4 * time.Millisecond, Multiplier: 2, MaxElapsed: time.Second}
+		attempts = 0
+		ctx = context.Background()
+	})
+
+	failTimes := func(n int) func() error {
+		return func() error {
+			attempts++
+			if attempts <= n {
+				return errors.New("unavailable")
+			}
+			return nil
+		}
+	}
+
+	It("retries until op succeeds", func() {
+		Expect(b.Retry(ctx, "test", failTimes(3))).To(Succeed())
+		Expect(attempts).To(Equal(4))
+	})
+
+	It("does not retry permanent errors", func() {
+		err := b.Retry(ctx, "test", func() error {
+			attempts++
+			return Permanent(errors.New("not found"))
+		})
+		Expect(err).To(MatchError("not found"))
+		Expect(attempts).To(Equal(1))
+	})
+
+	It("gives up after the max elapsed time", func() {
+		b.MaxElapsed = 10 * time.Millisecond
+		err := b.Retry(ctx, "test", failTimes(1000))
+		Expect(err).To(MatchError(ContainSubstring("gave up waiting for test")))
+		Expect(attempts).To(BeNumerically(">", 1))
+	})
+
+	It("stops when the context is done", func() {
+		ctx, cancel := context.WithCancel(ctx)
+		cancel()
+		b.MaxElapsed = 0
+		err := b.Retry(ctx, "test", failTimes(1000))
+		Expect(err).To(MatchError(ContainSubstring("context canceled")))
+		Expect(attempts).To(Equal(1))
+	})
+})